@@ -0,0 +1,284 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cloudwego/hertz/pkg/route"
+)
+
+var (
+	// ErrAsyncWriteDropped the write is dropped since the queue is full, see OverflowDrop
+	ErrAsyncWriteDropped = errors.New("cache async write dropped")
+	// ErrAsyncWriterClosed the AsyncWriter is closed and does not accept writes
+	ErrAsyncWriterClosed = errors.New("cache async writer closed")
+)
+
+// OverflowPolicy decides what happens to a write when the queue of the AsyncWriter is full
+type OverflowPolicy int
+
+const (
+	// OverflowDrop drops the write
+	OverflowDrop OverflowPolicy = iota
+	// OverflowBlock blocks the request until the queue has room
+	OverflowBlock
+	// OverflowSync writes synchronously in the request
+	OverflowSync
+)
+
+// AsyncWriterStats the counters of an AsyncWriter
+type AsyncWriterStats struct {
+	// Enqueued the number of writes put in the queue
+	Enqueued uint64
+	// Written the number of writes succeeded
+	Written uint64
+	// Failed the number of writes failed
+	Failed uint64
+	// Dropped the number of writes dropped on overflow or close
+	Dropped uint64
+	// Pending the number of writes not finished yet
+	Pending int
+}
+
+type asyncTask struct {
+	ctx   context.Context
+	write func(ctx context.Context) error
+}
+
+// AsyncWriter writes the responses to the cache stores in a bounded pool of workers,
+// so that the backend result is released before the store write finishes.
+type AsyncWriter struct {
+	queue  chan asyncTask
+	policy OverflowPolicy
+	stop   chan struct{}
+
+	// submitMu guards closed, Close waits for the in-progress submits with it
+	submitMu sync.RWMutex
+	closed   bool
+
+	mu       sync.Mutex
+	pending  int
+	flushing []chan struct{}
+	stopOnce sync.Once
+	workers  sync.WaitGroup
+
+	enqueued uint64
+	written  uint64
+	failed   uint64
+	dropped  uint64
+}
+
+// NewAsyncWriter create an AsyncWriter with the number of workers and the capacity of its queue
+func NewAsyncWriter(workers, queueSize int, policy OverflowPolicy) *AsyncWriter {
+	if workers <= 0 {
+		workers = 1
+	}
+	if queueSize < 0 {
+		queueSize = 0
+	}
+
+	w := &AsyncWriter{
+		queue:  make(chan asyncTask, queueSize),
+		policy: policy,
+		stop:   make(chan struct{}),
+	}
+	w.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go w.work()
+	}
+	return w
+}
+
+func (w *AsyncWriter) work() {
+	defer w.workers.Done()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case task := <-w.queue:
+			w.run(task)
+		}
+	}
+}
+
+func (w *AsyncWriter) run(task asyncTask) {
+	if err := task.write(task.ctx); err != nil {
+		atomic.AddUint64(&w.failed, 1)
+	} else {
+		atomic.AddUint64(&w.written, 1)
+	}
+	w.done()
+}
+
+// submit queues the write, the context passed to write is detached from the cancellation of ctx
+func (w *AsyncWriter) submit(ctx context.Context, write func(ctx context.Context) error) error {
+	w.submitMu.RLock()
+	defer w.submitMu.RUnlock()
+	if w.closed {
+		return ErrAsyncWriterClosed
+	}
+
+	w.mu.Lock()
+	w.pending++
+	w.mu.Unlock()
+
+	task := asyncTask{ctx: detachedContext{parent: ctx}, write: write}
+	select {
+	case w.queue <- task:
+		atomic.AddUint64(&w.enqueued, 1)
+		return nil
+	default:
+	}
+
+	switch w.policy {
+	case OverflowBlock:
+		select {
+		case w.queue <- task:
+			atomic.AddUint64(&w.enqueued, 1)
+			return nil
+		case <-w.stop:
+		}
+	case OverflowSync:
+		w.run(task)
+		return nil
+	}
+
+	atomic.AddUint64(&w.dropped, 1)
+	w.done()
+	return ErrAsyncWriteDropped
+}
+
+func (w *AsyncWriter) done() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pending--
+	if w.pending == 0 {
+		for _, ch := range w.flushing {
+			close(ch)
+		}
+		w.flushing = nil
+	}
+}
+
+// Flush blocks until all pending writes are finished or ctx is done
+func (w *AsyncWriter) Flush(ctx context.Context) error {
+	w.mu.Lock()
+	if w.pending == 0 {
+		w.mu.Unlock()
+		return nil
+	}
+	ch := make(chan struct{})
+	w.flushing = append(w.flushing, ch)
+	w.mu.Unlock()
+
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting writes, flushes the pending writes until ctx is done and stops the workers.
+// The writes left in the queue when ctx is done are dropped, and the ones in progress, e.g. stuck in a slow store,
+// are not waited for, their workers exit once they return.
+func (w *AsyncWriter) Close(ctx context.Context) error {
+	w.submitMu.Lock()
+	w.closed = true
+	w.submitMu.Unlock()
+
+	err := w.Flush(ctx)
+	w.stopOnce.Do(func() {
+		close(w.stop)
+	})
+
+	stopped := make(chan struct{})
+	go func() {
+		w.workers.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		if err == nil {
+			err = ctx.Err()
+		}
+	}
+
+	for {
+		select {
+		case <-w.queue:
+			atomic.AddUint64(&w.dropped, 1)
+			w.done()
+		default:
+			return err
+		}
+	}
+}
+
+// RegisterShutdown closes the AsyncWriter in the OnShutdown hooks of the engine,
+// so that the pending writes are flushed on graceful shutdown, e.g. w.RegisterShutdown(h.Engine).
+// The writer is closed before the stores registered with RegisterStoreShutdown on the same engine.
+func (w *AsyncWriter) RegisterShutdown(engine *route.Engine) {
+	hook := shutdownHookOf(engine)
+	hook.mu.Lock()
+	defer hook.mu.Unlock()
+	hook.writers = append(hook.writers, w)
+}
+
+// Stats returns the counters of the AsyncWriter
+func (w *AsyncWriter) Stats() AsyncWriterStats {
+	w.mu.Lock()
+	pending := w.pending
+	w.mu.Unlock()
+
+	return AsyncWriterStats{
+		Enqueued: atomic.LoadUint64(&w.enqueued),
+		Written:  atomic.LoadUint64(&w.written),
+		Failed:   atomic.LoadUint64(&w.failed),
+		Dropped:  atomic.LoadUint64(&w.dropped),
+		Pending:  pending,
+	}
+}
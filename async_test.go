@@ -0,0 +1,210 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/route"
+	"github.com/hertz-contrib/cache/persist"
+)
+
+func TestAsyncWriterDrop(t *testing.T) {
+	w := NewAsyncWriter(1, 1, OverflowDrop)
+	gate := make(chan struct{})
+	blocked := func(ctx context.Context) error {
+		<-gate
+		return nil
+	}
+
+	// the first write occupies the worker, the second fills the queue
+	assert.Nil(t, w.submit(context.Background(), blocked))
+	time.Sleep(10 * time.Millisecond)
+	assert.Nil(t, w.submit(context.Background(), func(ctx context.Context) error {
+		return errors.New("failed")
+	}))
+	assert.DeepEqual(t, ErrAsyncWriteDropped, w.submit(context.Background(), blocked))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.DeepEqual(t, context.DeadlineExceeded, w.Flush(ctx))
+
+	close(gate)
+	assert.Nil(t, w.Flush(context.Background()))
+	assert.DeepEqual(t, AsyncWriterStats{Enqueued: 2, Written: 1, Failed: 1, Dropped: 1}, w.Stats())
+
+	assert.Nil(t, w.Close(context.Background()))
+	assert.DeepEqual(t, ErrAsyncWriterClosed, w.submit(context.Background(), blocked))
+}
+
+func TestAsyncWriterOverflowSync(t *testing.T) {
+	w := NewAsyncWriter(1, 0, OverflowSync)
+	defer w.Close(context.Background())
+	// wait for the worker to receive from the unbuffered queue
+	time.Sleep(10 * time.Millisecond)
+
+	written := false
+	gate := make(chan struct{})
+	assert.Nil(t, w.submit(context.Background(), func(ctx context.Context) error {
+		<-gate
+		return nil
+	}))
+	time.Sleep(10 * time.Millisecond)
+	assert.Nil(t, w.submit(context.Background(), func(ctx context.Context) error {
+		written = true
+		return nil
+	}))
+	assert.True(t, written)
+	close(gate)
+}
+
+func TestAsyncWriterCloseDropsQueued(t *testing.T) {
+	w := NewAsyncWriter(1, 2, OverflowBlock)
+	gate := make(chan struct{})
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, w.submit(context.Background(), func(ctx context.Context) error {
+			<-gate
+			return nil
+		}))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	go func() {
+		<-ctx.Done()
+		close(gate)
+	}()
+	assert.DeepEqual(t, context.DeadlineExceeded, w.Close(ctx))
+	// the write in progress may finish after Close returns
+	assert.Nil(t, w.Flush(context.Background()))
+
+	stats := w.Stats()
+	assert.DeepEqual(t, 0, stats.Pending)
+	assert.DeepEqual(t, uint64(3), stats.Written+stats.Dropped)
+}
+
+func TestAsyncWriterCloseStuckWrite(t *testing.T) {
+	w := NewAsyncWriter(1, 1, OverflowBlock)
+	gate := make(chan struct{})
+	defer close(gate)
+	assert.Nil(t, w.submit(context.Background(), func(ctx context.Context) error {
+		<-gate
+		return nil
+	}))
+
+	// a write stuck in the store does not block Close past the deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	assert.DeepEqual(t, context.DeadlineExceeded, w.Close(ctx))
+	assert.True(t, time.Since(start) < time.Second)
+	assert.DeepEqual(t, 1, w.Stats().Pending)
+}
+
+func TestAsyncWrite(t *testing.T) {
+	memoryStore := persist.NewMemoryStore(1 * time.Minute)
+	asyncWriter := NewAsyncWriter(2, 16, OverflowBlock)
+
+	r := route.NewEngine(config.NewOptions([]config.Option{}))
+	asyncWriter.RegisterShutdown(r)
+	assert.DeepEqual(t, 1, len(r.OnShutdown))
+	r.Use(NewCacheByRequestURI(memoryStore, time.Minute, WithAsyncWriter(asyncWriter)))
+	r.GET("/cache", func(ctx context.Context, c *app.RequestContext) {
+		c.String(http.StatusOK, "uid:"+c.Query("uid"))
+	})
+
+	w := ut.PerformRequest(r, "GET", "/cache?uid=1", nil)
+	assert.DeepEqual(t, "uid:1", w.Body.String())
+
+	r.OnShutdown[0](context.Background())
+	respCache := &ResponseCache{}
+	assert.Nil(t, memoryStore.Get(context.Background(), "/cache?uid=1", &respCache))
+	assert.DeepEqual(t, "uid:1", string(respCache.Data))
+	assert.DeepEqual(t, uint64(1), asyncWriter.Stats().Written)
+
+	// write synchronously after closed
+	ut.PerformRequest(r, "GET", "/cache?uid=2", nil)
+	assert.Nil(t, memoryStore.Get(context.Background(), "/cache?uid=2", &respCache))
+}
+
+func TestAsyncWriteSharedResponse(t *testing.T) {
+	store := persist.NewShardedStore(time.Minute)
+	defer store.Close()
+	asyncWriter := NewAsyncWriter(2, 32, OverflowBlock)
+
+	r := route.NewEngine(config.NewOptions([]config.Option{}))
+	r.Use(NewCacheByRequestURI(store, time.Minute,
+		WithAsyncWriter(asyncWriter),
+		WithBeforeReplyWithCache(func(c *app.RequestContext, cache *ResponseCache) {
+			cache.Header.Set("X-Replied", "true")
+		})))
+	r.GET("/cache", func(ctx context.Context, c *app.RequestContext) {
+		time.Sleep(20 * time.Millisecond)
+		c.Header("X-Backend", "true")
+		c.String(http.StatusOK, "backend")
+	})
+
+	// the waiters of the single flight reply with the response while the worker encodes it, run with -race
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := ut.PerformRequest(r, "GET", "/cache", nil)
+			assert.DeepEqual(t, "backend", w.Body.String())
+		}()
+	}
+	wg.Wait()
+
+	assert.Nil(t, asyncWriter.Close(context.Background()))
+	respCache := &ResponseCache{}
+	assert.Nil(t, store.Get(context.Background(), "/cache", &respCache))
+	assert.DeepEqual(t, "backend", string(respCache.Data))
+}
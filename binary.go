@@ -0,0 +1,234 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package cache
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// responseCacheBinaryVersion the version of the binary format of ResponseCache
+const responseCacheBinaryVersion byte = 1
+
+// ErrMalformedResponseCache represent the binary payload is not a valid ResponseCache
+var ErrMalformedResponseCache = errors.New("cache malformed binary response")
+
+// MarshalBinary encodes the response into a versioned binary format, the stores use it instead of gob
+// when the value is a *ResponseCache.
+//
+// The format of version 1 is the version byte followed by uvarint status, the number of header keys,
+// each key with its number of values, the body, then varint created at and expire at in unix nanoseconds
+// (0 for the zero time) and the delta. The strings and the body are prefixed by their uvarint length.
+func (c *ResponseCache) MarshalBinary() ([]byte, error) {
+	size := 1 + 3*binary.MaxVarintLen64 + len(c.Data) + binary.MaxVarintLen64
+	for key, values := range c.Header {
+		size += 2*binary.MaxVarintLen64 + len(key)
+		for _, value := range values {
+			size += binary.MaxVarintLen64 + len(value)
+		}
+	}
+
+	e := binaryEncoder{buf: make([]byte, 0, size+3*binary.MaxVarintLen64)}
+	e.buf = append(e.buf, responseCacheBinaryVersion)
+	e.uvarint(uint64(c.Status))
+	e.uvarint(uint64(len(c.Header)))
+	for key, values := range c.Header {
+		e.string(key)
+		e.uvarint(uint64(len(values)))
+		for _, value := range values {
+			e.string(value)
+		}
+	}
+	e.uvarint(uint64(len(c.Data)))
+	e.buf = append(e.buf, c.Data...)
+	e.time(c.CreatedAt)
+	e.time(c.ExpireAt)
+	e.varint(int64(c.Delta))
+	return e.buf, nil
+}
+
+// UnmarshalBinary decodes the response encoded by MarshalBinary, returns ErrMalformedResponseCache if data is invalid
+func (c *ResponseCache) UnmarshalBinary(data []byte) error {
+	if len(data) == 0 {
+		return fmt.Errorf("%w: empty payload", ErrMalformedResponseCache)
+	}
+	if data[0] != responseCacheBinaryVersion {
+		return fmt.Errorf("%w: unsupported version %d", ErrMalformedResponseCache, data[0])
+	}
+
+	d := binaryDecoder{buf: data[1:]}
+	status := d.uvarint()
+	var header http.Header
+	// every key takes two bytes at least, so a count beyond it is malformed
+	if n := d.count(2); n > 0 {
+		header = make(http.Header, n)
+		for i := 0; i < n && d.err == nil; i++ {
+			key := d.string()
+			values := make([]string, d.count(1))
+			for j := range values {
+				values[j] = d.string()
+			}
+			header[key] = values
+		}
+	}
+	body := d.bytes()
+	createdAt := d.time()
+	expireAt := d.time()
+	delta := d.varint()
+	if d.err != nil {
+		return d.err
+	}
+	if len(d.buf) > 0 {
+		return fmt.Errorf("%w: %d trailing bytes", ErrMalformedResponseCache, len(d.buf))
+	}
+	if status > uint64(^uint(0)>>1) {
+		return fmt.Errorf("%w: invalid status %d", ErrMalformedResponseCache, status)
+	}
+
+	c.Status = int(status)
+	c.Header = header
+	c.Data = nil
+	if len(body) > 0 {
+		c.Data = append([]byte{}, body...)
+	}
+	c.CreatedAt = createdAt
+	c.ExpireAt = expireAt
+	c.Delta = time.Duration(delta)
+	return nil
+}
+
+type binaryEncoder struct {
+	buf     []byte
+	scratch [binary.MaxVarintLen64]byte
+}
+
+func (e *binaryEncoder) uvarint(v uint64) {
+	n := binary.PutUvarint(e.scratch[:], v)
+	e.buf = append(e.buf, e.scratch[:n]...)
+}
+
+func (e *binaryEncoder) varint(v int64) {
+	n := binary.PutVarint(e.scratch[:], v)
+	e.buf = append(e.buf, e.scratch[:n]...)
+}
+
+func (e *binaryEncoder) string(s string) {
+	e.uvarint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *binaryEncoder) time(t time.Time) {
+	if t.IsZero() {
+		e.varint(0)
+		return
+	}
+	e.varint(t.UnixNano())
+}
+
+// binaryDecoder consumes buf, the first error is kept and the following reads return zero values
+type binaryDecoder struct {
+	buf []byte
+	err error
+}
+
+func (d *binaryDecoder) fail(what string) {
+	if d.err == nil {
+		d.err = fmt.Errorf("%w: truncated %s", ErrMalformedResponseCache, what)
+	}
+	d.buf = nil
+}
+
+func (d *binaryDecoder) uvarint() uint64 {
+	v, n := binary.Uvarint(d.buf)
+	if n <= 0 {
+		d.fail("uvarint")
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+func (d *binaryDecoder) varint() int64 {
+	v, n := binary.Varint(d.buf)
+	if n <= 0 {
+		d.fail("varint")
+		return 0
+	}
+	d.buf = d.buf[n:]
+	return v
+}
+
+// count reads the number of the following elements, each taking minSize bytes at least,
+// so that a malformed count never allocates more than the payload
+func (d *binaryDecoder) count(minSize int) int {
+	n := d.uvarint()
+	if n > uint64(len(d.buf)/minSize) {
+		d.fail("count")
+		return 0
+	}
+	return int(n)
+}
+
+func (d *binaryDecoder) bytes() []byte {
+	n := d.uvarint()
+	if n > uint64(len(d.buf)) {
+		d.fail("bytes")
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *binaryDecoder) string() string {
+	return string(d.bytes())
+}
+
+func (d *binaryDecoder) time() time.Time {
+	nsec := d.varint()
+	if nsec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nsec)
+}
@@ -0,0 +1,198 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package cache
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/route"
+	"github.com/go-redis/redis/v8"
+	"github.com/hertz-contrib/cache/persist"
+)
+
+func newBinaryResponseCache() *ResponseCache {
+	createdAt := time.Unix(1666000000, 123456789)
+	return &ResponseCache{
+		Status: http.StatusOK,
+		Header: http.Header{
+			"Content-Type": {"application/json"},
+			"Set-Cookie":   {"a=1", "b=2"},
+		},
+		Data:      bytes.Repeat([]byte(`{"uid":1}`), 100),
+		CreatedAt: createdAt,
+		ExpireAt:  createdAt.Add(time.Minute),
+		Delta:     15 * time.Millisecond,
+	}
+}
+
+func TestResponseCacheBinary(t *testing.T) {
+	for _, src := range []*ResponseCache{newBinaryResponseCache(), {}} {
+		data, err := src.MarshalBinary()
+		assert.Nil(t, err)
+
+		dest := &ResponseCache{}
+		assert.Nil(t, dest.UnmarshalBinary(data))
+		assert.DeepEqual(t, src.Status, dest.Status)
+		assert.DeepEqual(t, src.Header, dest.Header)
+		assert.DeepEqual(t, src.Data, dest.Data)
+		assert.True(t, src.CreatedAt.Equal(dest.CreatedAt))
+		assert.True(t, src.ExpireAt.Equal(dest.ExpireAt))
+		assert.DeepEqual(t, src.Delta, dest.Delta)
+	}
+}
+
+func TestResponseCacheBinaryMalformed(t *testing.T) {
+	data, err := newBinaryResponseCache().MarshalBinary()
+	assert.Nil(t, err)
+
+	malformed := [][]byte{
+		nil,
+		{responseCacheBinaryVersion + 1},
+		// a header count beyond the payload
+		{responseCacheBinaryVersion, 200, 1, 0xff, 0xff, 0x03},
+		append(append([]byte{}, data...), 0),
+	}
+	for i := 1; i < len(data); i += 7 {
+		malformed = append(malformed, data[:i])
+	}
+	for _, payload := range malformed {
+		err := (&ResponseCache{}).UnmarshalBinary(payload)
+		assert.True(t, errors.Is(err, ErrMalformedResponseCache))
+	}
+}
+
+func TestResponseCacheBinaryRedis(t *testing.T) {
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:6379"})
+	r := route.NewEngine(config.NewOptions([]config.Option{}))
+	r.Use(NewCacheByRequestURI(persist.NewRedisStore(client), time.Minute))
+	r.GET("/binary", func(ctx context.Context, c *app.RequestContext) {
+		c.String(http.StatusOK, "binary")
+	})
+	defer client.Del(context.Background(), "/binary")
+
+	w := ut.PerformRequest(r, "GET", "/binary", nil)
+	assert.DeepEqual(t, "binary", w.Body.String())
+	payload, err := client.Get(context.Background(), "/binary").Bytes()
+	assert.Nil(t, err)
+	assert.True(t, bytes.Contains(payload, []byte{0xCA, persist.CodecIDBinary, responseCacheBinaryVersion}))
+
+	w = ut.PerformRequest(r, "GET", "/binary", nil)
+	assert.DeepEqual(t, "binary", w.Body.String())
+}
+
+func FuzzResponseCacheUnmarshalBinary(f *testing.F) {
+	data, _ := newBinaryResponseCache().MarshalBinary()
+	f.Add(data)
+	empty, _ := (&ResponseCache{}).MarshalBinary()
+	f.Add(empty)
+	f.Add([]byte{responseCacheBinaryVersion, 200, 1, 0xff, 0xff, 0x03})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		respCache := &ResponseCache{}
+		if err := respCache.UnmarshalBinary(data); err != nil {
+			if !errors.Is(err, ErrMalformedResponseCache) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			return
+		}
+
+		// a decoded response encodes and decodes to itself
+		encoded, err := respCache.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded := &ResponseCache{}
+		if err := decoded.UnmarshalBinary(encoded); err != nil {
+			t.Fatal(err)
+		}
+		if decoded.Status != respCache.Status || !bytes.Equal(decoded.Data, respCache.Data) ||
+			len(decoded.Header) != len(respCache.Header) || decoded.Delta != respCache.Delta {
+			t.Fatalf("round trip mismatch: %+v, %+v", respCache, decoded)
+		}
+	})
+}
+
+// gobResponseCache has the fields of ResponseCache without its binary marshaler, so that gob encodes it by reflection
+type gobResponseCache struct {
+	Status    int
+	Header    http.Header
+	Data      []byte
+	CreatedAt time.Time
+	ExpireAt  time.Time
+	Delta     time.Duration
+}
+
+func BenchmarkResponseCacheBinary(b *testing.B) {
+	src := newBinaryResponseCache()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		data, _ := src.MarshalBinary()
+		dest := &ResponseCache{}
+		if err := dest.UnmarshalBinary(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkResponseCacheGob(b *testing.B) {
+	src := gobResponseCache(*newBinaryResponseCache())
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(&src); err != nil {
+			b.Fatal(err)
+		}
+		dest := &gobResponseCache{}
+		if err := gob.NewDecoder(&buf).Decode(dest); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
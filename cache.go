@@ -67,6 +67,9 @@ type Strategy struct {
 
 	// CacheDuration
 	CacheDuration time.Duration
+
+	// TTLJitter if nil, use the global jitter instead
+	TTLJitter *TTLJitter
 }
 
 // GetCacheStrategyByRequest User can use this function to design custom cache strategy by request.
@@ -82,6 +85,7 @@ const (
 	writeResponseErrorFormat                 = "[CACHE] write response error: %s"
 	singleFlightErrorFormat                  = "[CACHE] call the function in-flight error: %s"
 	fallbackCacheKeyFormat                   = "[CACHE] Fallback to default cache key: %s"
+	asyncWriteDroppedFormat                  = "[CACHE] async write dropped, cache key: %s"
 )
 
 // NewCache user must pass getCacheKey to describe the way to generate cache key
@@ -104,10 +108,41 @@ func newCache(
 	}
 
 	sfGroup := singleflight.Group{}
+	bypass := &storeBypass{}
+	refreshing := &refreshSet{}
 
 	return func(ctx context.Context, c *app.RequestContext) {
 		shouldCache, cacheStrategy := options.getCacheStrategyByRequest(ctx, c)
+
+		// merge options
+		cacheStore := defaultCacheStore
+		if cacheStrategy.CacheStore != nil {
+			cacheStore = cacheStrategy.CacheStore
+		}
+
+		labels := MetricsLabels{
+			Route: c.FullPath(),
+			Store: StoreName(cacheStore),
+		}
+
+		if options.invalidateOnUnsafeMethods && isUnsafeMethod(c.Request.Method()) {
+			options.metrics.IncBypass(labels, BypassReasonUnsafeMethod)
+			options.emitEvent(ctx, c, Event{Kind: EventBypass, Store: labels.Store, Reason: BypassReasonUnsafeMethod})
+			c.Next(ctx)
+			invalidateByUnsafeRequest(ctx, c, cacheStore, options)
+			return
+		}
+
 		if !shouldCache {
+			options.metrics.IncBypass(labels, BypassReasonStrategy)
+			options.emitEvent(ctx, c, Event{Kind: EventBypass, Store: labels.Store, Reason: BypassReasonStrategy})
+			c.Next(ctx)
+			return
+		}
+
+		if bypass.active(cacheStore) {
+			options.metrics.IncBypass(labels, BypassReasonStoreUnavailable)
+			options.emitEvent(ctx, c, Event{Kind: EventBypass, Store: labels.Store, Reason: BypassReasonStoreUnavailable})
 			c.Next(ctx)
 			return
 		}
@@ -118,31 +153,80 @@ func newCache(
 			cacheKey = options.prefixKey + cacheKey
 		}
 
-		// merge options
-		cacheStore := defaultCacheStore
-		if cacheStrategy.CacheStore != nil {
-			cacheStore = cacheStrategy.CacheStore
-		}
-
 		cacheDuration := defaultExpire
 		if cacheStrategy.CacheDuration > 0 {
 			cacheDuration = cacheStrategy.CacheDuration
 		}
+		cacheDuration = options.jitterTTL(cacheDuration, cacheStrategy.TTLJitter)
+
+		event := Event{
+			Key:   cacheKey,
+			Store: labels.Store,
+			TTL:   cacheDuration,
+		}
+
+		keyHashAttr := Attribute{Key: AttrKeyHash, Value: hashKey(cacheKey)}
+		storeAttr := Attribute{Key: AttrStore, Value: labels.Store}
 
 		// read cache first
 		{
+			lookupCtx, lookupSpan := options.tracer.Start(ctx, SpanNameLookup)
+			lookupSpan.SetAttributes(keyHashAttr, storeAttr)
+
 			respCache := &ResponseCache{}
-			err := cacheStore.Get(ctx, cacheKey, &respCache)
+			getCtx, cancel := options.readContext(lookupCtx)
+			start := time.Now()
+			err := cacheStore.Get(getCtx, cacheKey, &respCache)
+			cancel()
+			options.metrics.ObserveStoreLatency(labels, storeOpGet, time.Since(start))
 			if err == nil {
-				replyWithCache(ctx, c, options, respCache)
-				options.hitCacheCallback(ctx, c)
-				return
-			}
+				if !options.expiresEarly(respCache) || !refreshing.start(cacheKey) {
+					lookupSpan.SetAttributes(
+						Attribute{Key: AttrOutcome, Value: OutcomeHit},
+						Attribute{Key: AttrPayloadSize, Value: len(respCache.Data)},
+					)
+					lookupSpan.End()
+
+					replyWithCache(ctx, c, options, respCache)
+					options.metrics.IncHit(labels)
+					options.emitEvent(ctx, c, event.withResponse(EventHit, respCache))
+					return
+				}
+
+				// the entry is considered expired ahead of its expiration, this request refreshes it
+				// while the others still hit
+				defer refreshing.done(cacheKey)
+				lookupSpan.SetAttributes(Attribute{Key: AttrOutcome, Value: OutcomeStale})
+				lookupSpan.End()
 
-			if !errors.Is(err, persist.ErrCacheMiss) {
-				hlog.CtxErrorf(ctx, getCacheErrorFormat, err, cacheKey)
+				options.metrics.IncMiss(labels)
+				options.emitEvent(ctx, c, event.withResponse(EventStale, respCache))
+			} else {
+				// a miss carrying a cause, e.g. an entry failing to decrypt, is reported without the error policy
+				isMiss := errors.Is(err, persist.ErrCacheMiss)
+				var storeErr *persist.StoreError
+				if !isMiss || errors.As(err, &storeErr) {
+					hlog.CtxErrorf(ctx, getCacheErrorFormat, err, cacheKey)
+					options.metrics.IncStoreError(labels, storeOpGet)
+					options.emitEvent(ctx, c, event.withError(storeOpGet, err))
+					lookupSpan.RecordError(err)
+				}
+				if !isMiss {
+					switch options.storeErrorPolicyFunc(storeOpGet, err) {
+					case StoreErrorPolicyFailClosed:
+						lookupSpan.End()
+						c.AbortWithStatus(http.StatusServiceUnavailable)
+						return
+					case StoreErrorPolicyBypass:
+						bypass.mark(cacheStore, options.storeBypassDuration)
+					}
+				}
+				lookupSpan.SetAttributes(Attribute{Key: AttrOutcome, Value: OutcomeMiss})
+				lookupSpan.End()
+
+				options.metrics.IncMiss(labels)
+				options.emitEvent(ctx, c, event.withKind(EventMiss))
 			}
-			options.missCacheCallback(ctx, c)
 		}
 
 		// cache miss, then call the backend
@@ -152,7 +236,10 @@ func newCache(
 			Response: &c.Response,
 		}
 
-		inFlight := false
+		sfCtx, sfSpan := options.tracer.Start(ctx, SpanNameSingleFlight)
+		sfSpan.SetAttributes(keyHashAttr, storeAttr)
+
+		inFlight, fromStore := false, false
 		rawRespCache, err, _ := sfGroup.Do(cacheKey, func() (interface{}, error) {
 			if options.singleFlightForgetTimeout > 0 {
 				forgetTimer := time.AfterFunc(options.singleFlightForgetTimeout, func() {
@@ -161,17 +248,109 @@ func newCache(
 				defer forgetTimer.Stop()
 			}
 
-			c.Next(ctx)
+			leaderCtx := sfCtx
+			var lock persist.Lock
+			if options.locker != nil {
+				var respCache *ResponseCache
+				lock, respCache = obtainLockOrWait(leaderCtx, options, cacheStore, cacheKey)
+				if respCache != nil {
+					fromStore = true
+					return respCache, nil
+				}
+				if lock != nil {
+					leaderCtx = persist.WithLockToken(leaderCtx, lock.Token())
+				}
+			}
+			// the lock is released once the response is stored, which may be after an async write
+			releaseAfterWrite := false
+			defer func() {
+				if lock != nil && !releaseAfterWrite {
+					releaseLock(leaderCtx, options, lock, cacheKey)
+				}
+			}()
+
+			handlerCtx, handlerSpan := options.tracer.Start(leaderCtx, SpanNameHandler)
+			handlerStart := time.Now()
+			c.Next(handlerCtx)
+			delta := time.Since(handlerStart)
+			handlerSpan.End()
 
 			inFlight = true
 
 			respCache := &ResponseCache{}
 			respCache.fillWithCacheWriter(cacheWriter, options.withoutHeader)
+			respCache.CreatedAt = time.Now()
+			respCache.ExpireAt = respCache.CreatedAt.Add(cacheDuration)
+			respCache.Delta = delta
 
 			// only cache 2xx response
 			if !c.IsAborted() && cacheWriter.StatusCode() < 300 && cacheWriter.StatusCode() >= 200 {
-				if err := cacheStore.Set(ctx, cacheKey, respCache, cacheDuration); err != nil {
-					hlog.CtxErrorf(ctx, setCacheKeyErrorFormat, err, cacheKey)
+				record := warmRecordOf(ctx)
+				setCache := func(ctx context.Context, respCache *ResponseCache) error {
+					storeCtx, storeSpan := options.tracer.Start(ctx, SpanNameStore)
+					defer storeSpan.End()
+					storeSpan.SetAttributes(keyHashAttr, storeAttr, Attribute{Key: AttrPayloadSize, Value: len(respCache.Data)})
+
+					setCtx, cancel := options.writeContext(storeCtx)
+					start := time.Now()
+					err := cacheStore.Set(setCtx, cacheKey, respCache, cacheDuration)
+					cancel()
+					options.metrics.ObserveStoreLatency(labels, storeOpSet, time.Since(start))
+					if errors.Is(err, persist.ErrStaleLockToken) {
+						// the lock expired and another instance regenerates the key, its response wins
+						hlog.CtxWarnf(ctx, staleLockWriteFormat, cacheKey)
+						storeSpan.RecordError(err)
+						return err
+					}
+					if err != nil {
+						hlog.CtxErrorf(ctx, setCacheKeyErrorFormat, err, cacheKey)
+						options.metrics.IncStoreError(labels, storeOpSet)
+						storeSpan.RecordError(err)
+
+						if options.storeErrorPolicyFunc(storeOpSet, err) == StoreErrorPolicyBypass {
+							bypass.mark(cacheStore, options.storeBypassDuration)
+						}
+						return err
+					}
+
+					options.metrics.AddStoredBytes(labels, len(respCache.Data))
+					record.markStored()
+					return nil
+				}
+
+				writeSync := true
+				if options.asyncWriter != nil {
+					// the waiters of the single flight reply with respCache while the worker encodes it, write a copy
+					stored := respCache.Clone()
+					record.add()
+					write := func(ctx context.Context) error {
+						defer record.done()
+						if lock != nil {
+							defer releaseLock(ctx, options, lock, cacheKey)
+						}
+						return setCache(ctx, stored)
+					}
+					err := options.asyncWriter.submit(leaderCtx, write)
+					if err != nil {
+						record.done()
+					}
+					switch {
+					case err == nil:
+						releaseAfterWrite = true
+						writeSync = false
+					case errors.Is(err, ErrAsyncWriteDropped):
+						hlog.CtxWarnf(ctx, asyncWriteDroppedFormat, cacheKey)
+						writeSync = false
+					}
+				}
+
+				// write synchronously without an AsyncWriter or after it is closed
+				if writeSync {
+					if err := setCache(leaderCtx, respCache); err != nil {
+						options.emitEvent(ctx, c, event.withError(storeOpSet, err))
+					} else {
+						options.emitEvent(ctx, c, event.withResponse(EventSet, respCache))
+					}
 				}
 			}
 
@@ -180,11 +359,31 @@ func newCache(
 
 		if err != nil {
 			hlog.CtxErrorf(ctx, singleFlightErrorFormat, err)
+			sfSpan.RecordError(err)
 		}
 
+		sfOutcome := OutcomeShared
+		switch {
+		case inFlight:
+			sfOutcome = OutcomeLeader
+		case fromStore:
+			sfOutcome = OutcomeHit
+		}
+		sfSpan.SetAttributes(Attribute{Key: AttrOutcome, Value: sfOutcome})
+		sfSpan.End()
+
 		if !inFlight {
-			replyWithCache(ctx, c, options, rawRespCache.(*ResponseCache))
-			options.shareSingleFlightCallback(ctx, c)
+			// the waiters of the single flight share the result, reply with a copy the callback may modify
+			respCache := rawRespCache.(*ResponseCache).Clone()
+			replyWithCache(ctx, c, options, respCache)
+			if fromStore {
+				// the response is generated by the lock holder of another instance
+				options.metrics.IncHit(labels)
+				options.emitEvent(ctx, c, event.withResponse(EventHit, respCache))
+			} else {
+				options.metrics.IncShared(labels)
+				options.emitEvent(ctx, c, event.withResponse(EventShared, respCache))
+			}
 		}
 	}
 }
@@ -230,7 +429,7 @@ func NewCacheByKeyStrategy(defaultCacheStore persist.CacheStore, defaultExpire t
 	}
 
 	var options []Option
-	options = append(options, WithCacheStrategyByRequest(cacheStrategy))
+	options = append(options, WithCacheStrategyByRequest(cacheStrategy), WithInvalidateKeyStrategy(strategy))
 	options = append(options, opts...)
 
 	return NewCache(defaultCacheStore, defaultExpire, options...)
@@ -293,6 +492,44 @@ type ResponseCache struct {
 	Status int
 	Header http.Header
 	Data   []byte
+
+	// CreatedAt the time when the response is generated by the backend
+	CreatedAt time.Time
+	// ExpireAt the time when the response expires in the store
+	ExpireAt time.Time
+	// Delta the duration taken by the backend to generate the response
+	Delta time.Duration
+}
+
+// responseCacheSchemaVersion must be increased whenever the fields of ResponseCache change,
+// so that the entries written by the previous releases are misses instead of decoding into garbage
+const responseCacheSchemaVersion = 1
+
+// SchemaVersion implements persist.Versioned
+func (c *ResponseCache) SchemaVersion() uint32 {
+	return responseCacheSchemaVersion
+}
+
+// Clone returns a deep copy of the response, so that it can be mutated without changing the cached one
+func (c *ResponseCache) Clone() *ResponseCache {
+	clone := *c
+	clone.Header = c.Header.Clone()
+	if c.Data != nil {
+		clone.Data = append([]byte{}, c.Data...)
+	}
+	return &clone
+}
+
+// Size implements persist.Sized, it is the size of the body and the headers
+func (c *ResponseCache) Size() int {
+	size := len(c.Data)
+	for key, values := range c.Header {
+		size += len(key)
+		for _, value := range values {
+			size += len(value)
+		}
+	}
+	return size
 }
 
 func (c *ResponseCache) fillWithCacheWriter(cacheWriter *responseCacheWriter, withoutHeader bool) {
@@ -46,6 +46,7 @@ import (
 	"io"
 	"math/rand"
 	"net/http"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -313,3 +314,62 @@ func TestCacheByURIWithIgnoreQueryOrder(t *testing.T) {
 
 	assert.DeepEqual(t, w1.Body, w2.Body)
 }
+
+func TestBoundedMemoryStore(t *testing.T) {
+	respCache := &ResponseCache{Header: http.Header{"Ab": {"cd"}}, Data: []byte("body")}
+	assert.DeepEqual(t, 8, respCache.Size())
+
+	memoryStore := persist.NewMemoryStore(1*time.Minute, persist.WithMaxEntries(2))
+	handler := hertzHandler(NewCacheByRequestURI(memoryStore, 3*time.Second, WithoutHeader(true)), false)
+
+	for _, uid := range []string{"u1", "u2", "u3"} {
+		w := ut.PerformRequest(handler, "GET", "/cache?uid="+uid, nil)
+		assert.DeepEqual(t, "uid:"+uid, w.Body.String())
+	}
+	assert.DeepEqual(t, persist.MemoryStoreStats{Entries: 2, Bytes: 12, Evictions: 1}, memoryStore.Stats())
+	assert.DeepEqual(t, persist.ErrCacheMiss, memoryStore.Get(context.Background(), "/cache?uid=u1", &respCache))
+}
+
+func TestMemoryStoreIsolation(t *testing.T) {
+	for _, mode := range []persist.IsolationMode{persist.IsolationCopy, persist.IsolationSerialize} {
+		memoryStore := persist.NewMemoryStore(1*time.Minute, persist.WithIsolation(mode))
+		handler := hertzHandler(NewCacheByRequestURI(memoryStore, 3*time.Second,
+			WithBeforeReplyWithCache(func(c *app.RequestContext, cache *ResponseCache) {
+				cache.Header.Set("X-Reply", cache.Header.Get("X-Reply")+"+")
+				cache.Data = append(cache.Data, '!')
+			})), false)
+
+		ut.PerformRequest(handler, "GET", "/cache?uid=1", nil)
+		for i := 0; i < 3; i++ {
+			w := ut.PerformRequest(handler, "GET", "/cache?uid=1", nil)
+			assert.DeepEqual(t, "uid:1!", w.Body.String())
+			assert.DeepEqual(t, "+", w.Header().Get("X-Reply"))
+		}
+	}
+}
+
+func BenchmarkMemoryStoreIsolation(b *testing.B) {
+	ctx := context.Background()
+	src := &ResponseCache{
+		Status: http.StatusOK,
+		Header: http.Header{"Content-Type": {"application/json"}, "Cache-Control": {"max-age=60"}},
+		Data:   []byte(strings.Repeat(`{"uid":1}`, 100)),
+	}
+
+	for _, mode := range []persist.IsolationMode{persist.IsolationShared, persist.IsolationCopy, persist.IsolationSerialize} {
+		memoryStore := persist.NewMemoryStore(time.Minute, persist.WithIsolation(mode))
+		if err := memoryStore.Set(ctx, "key", src, time.Minute); err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(mode.String(), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				respCache := &ResponseCache{}
+				if err := memoryStore.Get(ctx, "key", &respCache); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
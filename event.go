@@ -0,0 +1,139 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+)
+
+// EventKind the kind of cache Event
+type EventKind string
+
+const (
+	// EventHit the response is replied from the cache store
+	EventHit EventKind = "hit"
+	// EventMiss the cache store does not have the response
+	EventMiss EventKind = "miss"
+	// EventBypass the request is passed through without caching, see Event.Reason
+	EventBypass EventKind = "bypass"
+	// EventStoreError a cache store operation failed, see Event.Op and Event.Err
+	EventStoreError EventKind = "store_error"
+	// EventSet the response is written to the cache store
+	EventSet EventKind = "set"
+	// EventShared the response is shared from another in-flight request
+	EventShared EventKind = "shared"
+	// EventStale the cached response is considered stale before its expiration and the backend is called,
+	// it is counted and reported to the OnMissCache callback as a miss
+	EventStale EventKind = "stale"
+)
+
+// Event describes what happened to a cached request
+type Event struct {
+	Kind EventKind
+	// Key the cache key including the prefix, empty for bypass
+	Key string
+	// Store the name of the cache store, see StoreName
+	Store string
+	// TTL the cache duration of the entry
+	TTL time.Duration
+	// Age the time elapsed since the entry was stored, only set for hit, shared and stale
+	Age time.Duration
+	// BodySize the size of the response body
+	BodySize int
+	// Reason why the request is bypassed, only set for bypass
+	Reason BypassReason
+	// Op the failed store operation, only set for store_error
+	Op string
+	// Err the error of the store operation, only set for store_error
+	Err error
+}
+
+// OnEventCallback define the callback for every cache event
+type OnEventCallback func(ctx context.Context, c *app.RequestContext, event Event)
+
+var defaultEventCallback = func(ctx context.Context, c *app.RequestContext, event Event) {}
+
+// emitEvent dispatches the event to the event callback and the callback of its kind
+func (o *Options) emitEvent(ctx context.Context, c *app.RequestContext, event Event) {
+	switch event.Kind {
+	case EventHit:
+		o.hitCacheCallback(ctx, c)
+	case EventMiss, EventStale:
+		o.missCacheCallback(ctx, c)
+	case EventShared:
+		o.shareSingleFlightCallback(ctx, c)
+	case EventStoreError:
+		o.storeErrorCallback(ctx, c, event.Op, event.Err)
+	}
+	o.eventCallback(ctx, c, event)
+}
+
+func (e Event) withKind(kind EventKind) Event {
+	e.Kind = kind
+	return e
+}
+
+func (e Event) withResponse(kind EventKind, respCache *ResponseCache) Event {
+	e.Kind = kind
+	e.BodySize = len(respCache.Data)
+	if kind != EventSet {
+		e.Age = entryAge(respCache)
+	}
+	return e
+}
+
+func (e Event) withError(op string, err error) Event {
+	e.Kind = EventStoreError
+	e.Op = op
+	e.Err = err
+	return e
+}
+
+// entryAge returns the age of the cached response, zero if unknown
+func entryAge(respCache *ResponseCache) time.Duration {
+	if respCache.CreatedAt.IsZero() {
+		return 0
+	}
+	return time.Since(respCache.CreatedAt)
+}
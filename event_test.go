@@ -0,0 +1,138 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/hertz-contrib/cache/persist"
+)
+
+var errStoreUnavailable = errors.New("store unavailable")
+
+// failingStore fails every operation
+type failingStore struct{}
+
+func (failingStore) Get(ctx context.Context, key string, value interface{}) error {
+	return errStoreUnavailable
+}
+
+func (failingStore) Set(ctx context.Context, key string, value interface{}, expire time.Duration) error {
+	return errStoreUnavailable
+}
+
+func (failingStore) Delete(ctx context.Context, key string) error {
+	return errStoreUnavailable
+}
+
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *eventRecorder) record(ctx context.Context, c *app.RequestContext, event Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *eventRecorder) kinds() []EventKind {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	kinds := make([]EventKind, 0, len(r.events))
+	for _, event := range r.events {
+		kinds = append(kinds, event.Kind)
+	}
+	return kinds
+}
+
+func TestOnEvent(t *testing.T) {
+	recorder := &eventRecorder{}
+	hitCount := 0
+	memoryStore := persist.NewMemoryStore(1 * time.Minute)
+	handler := hertzHandler(NewCacheByRequestURI(memoryStore, 3*time.Second,
+		WithOnEvent(recorder.record),
+		WithOnHitCache(func(ctx context.Context, c *app.RequestContext) {
+			hitCount++
+		}),
+	), false)
+
+	ut.PerformRequest(handler, "GET", "/cache?uid=1", nil)
+	time.Sleep(10 * time.Millisecond)
+	ut.PerformRequest(handler, "GET", "/cache?uid=1", nil)
+
+	assert.DeepEqual(t, []EventKind{EventMiss, EventSet, EventHit}, recorder.kinds())
+	assert.DeepEqual(t, 1, hitCount)
+
+	set, hit := recorder.events[1], recorder.events[2]
+	assert.DeepEqual(t, "/cache?uid=1", set.Key)
+	assert.DeepEqual(t, "MemoryStore", set.Store)
+	assert.DeepEqual(t, 3*time.Second, set.TTL)
+	assert.DeepEqual(t, len("uid:1"), set.BodySize)
+	assert.DeepEqual(t, len("uid:1"), hit.BodySize)
+	assert.True(t, hit.Age >= 10*time.Millisecond)
+}
+
+func TestOnEventStoreError(t *testing.T) {
+	recorder := &eventRecorder{}
+	handler := hertzHandler(NewCacheByRequestURI(failingStore{}, 3*time.Second,
+		WithOnEvent(recorder.record),
+		WithInvalidateOnUnsafeMethods(true),
+	), false)
+	handler.DELETE("/cache", func(ctx context.Context, c *app.RequestContext) {})
+
+	ut.PerformRequest(handler, "GET", "/cache", nil)
+	ut.PerformRequest(handler, "DELETE", "/cache", nil)
+
+	assert.DeepEqual(t, []EventKind{EventStoreError, EventMiss, EventStoreError, EventBypass, EventStoreError}, recorder.kinds())
+	assert.DeepEqual(t, storeOpGet, recorder.events[0].Op)
+	assert.DeepEqual(t, errStoreUnavailable, recorder.events[0].Err)
+	assert.DeepEqual(t, storeOpSet, recorder.events[2].Op)
+	assert.DeepEqual(t, BypassReasonUnsafeMethod, recorder.events[3].Reason)
+	assert.DeepEqual(t, storeOpDelete, recorder.events[4].Op)
+}
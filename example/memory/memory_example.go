@@ -56,6 +56,8 @@ func main() {
 
 	memoryStore := persist.NewMemoryStore(1 * time.Minute)
 
+	cache.RegisterStoreShutdown(h.Engine, memoryStore)
+
 	h.Use(cache.NewCacheByRequestURI(memoryStore, 2*time.Second))
 	h.GET("/hello", func(ctx context.Context, c *app.RequestContext) {
 		c.String(http.StatusOK, "hello world")
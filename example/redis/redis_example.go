@@ -60,6 +60,8 @@ func main() {
 		Addr:    "127.0.0.1:6379",
 	}))
 
+	cache.RegisterStoreShutdown(h.Engine, redisStore)
+
 	h.Use(cache.NewCacheByRequestURI(redisStore, 2*time.Second))
 	h.GET("/hello", func(ctx context.Context, c *app.RequestContext) {
 		c.String(http.StatusOK, "hello world")
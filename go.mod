@@ -6,6 +6,9 @@ require (
 	github.com/cloudwego/hertz v0.4.2
 	github.com/go-redis/redis/v8 v8.11.5
 	github.com/jellydator/ttlcache/v2 v2.11.1
+	go.opentelemetry.io/otel v1.10.0
+	go.opentelemetry.io/otel/sdk v1.10.0
+	go.opentelemetry.io/otel/trace v1.10.0
 	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c
 )
 
@@ -18,6 +21,8 @@ require (
 	github.com/cloudwego/netpoll v0.3.1 // indirect
 	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
 	github.com/fsnotify/fsnotify v1.5.4 // indirect
+	github.com/go-logr/logr v1.2.3 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
 	github.com/golang/protobuf v1.5.0 // indirect
 	github.com/henrylee2cn/ameda v1.4.10 // indirect
 	github.com/henrylee2cn/goutil v0.0.0-20210127050712-89660552f6f8 // indirect
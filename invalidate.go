@@ -0,0 +1,210 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"path"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/hertz-contrib/cache/persist"
+)
+
+const headerContentLocation = "Content-Location"
+
+const (
+	deleteCacheKeyErrorFormat       = "[CACHE] delete cache key error: %s, cache key: %s"
+	deleteCacheKeyPrefixErrorFormat = "[CACHE] delete cache key prefix error: %s, prefix: %s"
+	invalidateKeyErrorFormat        = "[CACHE] generate invalidation key error: %s, uri: %s"
+)
+
+// isUnsafeMethod reports whether the method may change the state of the target resource, see RFC 9111 §4.4
+func isUnsafeMethod(method []byte) bool {
+	switch string(method) {
+	case consts.MethodPost, consts.MethodPut, consts.MethodPatch, consts.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// invalidateByUnsafeRequest removes the cached responses affected by a successful unsafe request.
+// The request URI and the same-origin Location and Content-Location targets are invalidated,
+// and so are the configured number of parent paths with the cached responses under them.
+func invalidateByUnsafeRequest(
+	ctx context.Context,
+	c *app.RequestContext,
+	cacheStore persist.CacheStore,
+	options *Options,
+) {
+	status := c.Response.StatusCode()
+	if c.IsAborted() || status < 200 || status >= 300 {
+		return
+	}
+
+	keyStrategy := options.invalidateKeyStrategy
+	if keyStrategy == nil {
+		keyStrategy = &ByURI{}
+	}
+
+	deleted := make(map[string]struct{})
+	deleteKey := func(cacheKey string) {
+		if _, ok := deleted[cacheKey]; ok {
+			return
+		}
+		deleted[cacheKey] = struct{}{}
+
+		deleteCtx, cancel := options.writeContext(ctx)
+		err := cacheStore.Delete(deleteCtx, cacheKey)
+		cancel()
+		if err != nil {
+			hlog.CtxErrorf(ctx, deleteCacheKeyErrorFormat, err, cacheKey)
+			emitDeleteError(ctx, c, cacheStore, options, cacheKey, err)
+		}
+	}
+
+	for _, uri := range invalidationURIs(c) {
+		cacheKey, err := generateKeyForURI(c, keyStrategy, uri)
+		if err != nil {
+			hlog.CtxErrorf(ctx, invalidateKeyErrorFormat, err, uri)
+			continue
+		}
+		deleteKey(options.prefixKey + cacheKey)
+	}
+
+	for _, dir := range parentPaths(c, options.invalidateParentDepth) {
+		cacheKey, err := generateKeyForURI(c, keyStrategy, dir)
+		if err != nil {
+			hlog.CtxErrorf(ctx, invalidateKeyErrorFormat, err, dir)
+			continue
+		}
+		cacheKey = options.prefixKey + cacheKey
+		deleteKey(cacheKey)
+
+		// purge the query string variants of the parent and the paths under it,
+		// but not the paths under the root, which would purge the whole cache
+		prefixes := []string{cacheKey + "?"}
+		if dir != "/" {
+			prefixes = append(prefixes, cacheKey+"/")
+		}
+		for _, prefix := range prefixes {
+			deleteCtx, cancel := options.writeContext(ctx)
+			err := persist.DeletePrefix(deleteCtx, cacheStore, prefix)
+			cancel()
+			// the stores without prefix support only drop the parent itself
+			if err != nil && !errors.Is(err, persist.ErrPrefixDeleteUnsupported) {
+				hlog.CtxErrorf(ctx, deleteCacheKeyPrefixErrorFormat, err, prefix)
+				emitDeleteError(ctx, c, cacheStore, options, prefix, err)
+			}
+		}
+	}
+}
+
+// emitDeleteError emits the EventStoreError of a failed invalidation
+func emitDeleteError(
+	ctx context.Context,
+	c *app.RequestContext,
+	cacheStore persist.CacheStore,
+	options *Options,
+	key string,
+	err error,
+) {
+	options.emitEvent(ctx, c, Event{
+		Kind:  EventStoreError,
+		Key:   key,
+		Store: StoreName(cacheStore),
+		Op:    storeOpDelete,
+		Err:   err,
+	})
+}
+
+// invalidationURIs returns the request URIs whose cached GET responses become stale after the unsafe request
+func invalidationURIs(c *app.RequestContext) []string {
+	requestURI := string(c.Request.RequestURI())
+	uris := []string{requestURI}
+
+	base, err := url.ParseRequestURI(requestURI)
+	if err != nil {
+		return uris
+	}
+	host := string(c.Request.Host())
+
+	for _, header := range []string{consts.HeaderLocation, headerContentLocation} {
+		value := c.Response.Header.Get(header)
+		if value == "" {
+			continue
+		}
+		target, err := base.Parse(value)
+		if err != nil {
+			continue
+		}
+		// only invalidate the same origin to prevent denial-of-service attacks, see RFC 9111 §4.4
+		if target.Host != "" && target.Host != host {
+			continue
+		}
+		uris = append(uris, target.RequestURI())
+	}
+
+	return uris
+}
+
+// parentPaths returns up to depth parent paths of the request path, the nearest first
+func parentPaths(c *app.RequestContext, depth int) []string {
+	var dirs []string
+	dir := string(c.Request.URI().Path())
+	for i := 0; i < depth && dir != "/"; i++ {
+		dir = path.Dir(dir)
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
+
+// generateKeyForURI runs the key strategy against a GET request for uri carrying the headers of c
+func generateKeyForURI(c *app.RequestContext, keyStrategy KeyStrategy, uri string) (string, error) {
+	tmp := app.NewContext(0)
+	c.Request.Header.CopyTo(&tmp.Request.Header)
+	tmp.Request.SetMethod(consts.MethodGet)
+	tmp.Request.SetRequestURI(uri)
+	return keyStrategy.GenerateKey(tmp)
+}
@@ -0,0 +1,174 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package cache
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/route"
+	"github.com/hertz-contrib/cache/persist"
+)
+
+func hertzUnsafeHandler(middleware app.HandlerFunc) *route.Engine {
+	r := route.NewEngine(config.NewOptions([]config.Option{}))
+
+	r.Use(middleware)
+	randHandler := func(ctx context.Context, c *app.RequestContext) {
+		c.String(http.StatusOK, fmt.Sprintf("rand:%d", rand.Int()))
+	}
+	r.GET("/users", randHandler)
+	r.GET("/users/:id", randHandler)
+	r.GET("/other", randHandler)
+	r.POST("/users", func(ctx context.Context, c *app.RequestContext) {
+		c.Header("Location", "/users/1")
+		c.Status(http.StatusCreated)
+	})
+	r.PUT("/users/:id", func(ctx context.Context, c *app.RequestContext) {
+		c.Header("Content-Location", "http://other.example.com/other")
+		c.Status(http.StatusOK)
+	})
+	r.DELETE("/users/:id", func(ctx context.Context, c *app.RequestContext) {
+		if c.Param("id") == "0" {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	return r
+}
+
+func TestInvalidateOnUnsafeMethods(t *testing.T) {
+	memoryStore := persist.NewMemoryStore(1 * time.Minute)
+	handler := hertzUnsafeHandler(NewCacheByRequestURI(memoryStore, 1*time.Minute,
+		WithInvalidateOnUnsafeMethods(true)))
+
+	w1 := ut.PerformRequest(handler, "GET", "/users/1", nil)
+	w2 := ut.PerformRequest(handler, "DELETE", "/users/1", nil)
+	assert.DeepEqual(t, http.StatusNoContent, w2.Code)
+	w3 := ut.PerformRequest(handler, "GET", "/users/1", nil)
+	assert.NotEqual(t, w1.Body.String(), w3.Body.String())
+
+	// failed unsafe requests do not invalidate
+	w4 := ut.PerformRequest(handler, "GET", "/users/0", nil)
+	ut.PerformRequest(handler, "DELETE", "/users/0", nil)
+	w5 := ut.PerformRequest(handler, "GET", "/users/0", nil)
+	assert.DeepEqual(t, w4.Body.String(), w5.Body.String())
+}
+
+func TestInvalidateLocation(t *testing.T) {
+	memoryStore := persist.NewMemoryStore(1 * time.Minute)
+	handler := hertzUnsafeHandler(NewCacheByRequestPath(memoryStore, 1*time.Minute,
+		WithInvalidateOnUnsafeMethods(true)))
+
+	w1 := ut.PerformRequest(handler, "GET", "/users/1", nil)
+	w2 := ut.PerformRequest(handler, "GET", "/users/1", nil)
+	assert.DeepEqual(t, w1.Body.String(), w2.Body.String())
+
+	ut.PerformRequest(handler, "POST", "/users", nil)
+	w3 := ut.PerformRequest(handler, "GET", "/users/1", nil)
+	assert.NotEqual(t, w1.Body.String(), w3.Body.String())
+
+	// a Content-Location of another origin must not be invalidated
+	w4 := ut.PerformRequest(handler, "GET", "/other", nil)
+	ut.PerformRequest(handler, "PUT", "/users/1", nil)
+	w5 := ut.PerformRequest(handler, "GET", "/other", nil)
+	assert.DeepEqual(t, w4.Body.String(), w5.Body.String())
+}
+
+func TestInvalidateParentPath(t *testing.T) {
+	memoryStore := persist.NewMemoryStore(1 * time.Minute)
+	handler := hertzUnsafeHandler(NewCacheByRequestURI(memoryStore, 1*time.Minute,
+		WithInvalidateOnUnsafeMethods(true),
+		WithInvalidateParentPath(1),
+		WithPrefixKey(prefixKey)))
+
+	w1 := ut.PerformRequest(handler, "GET", "/users", nil)
+	w2 := ut.PerformRequest(handler, "GET", "/users?page=2", nil)
+	w3 := ut.PerformRequest(handler, "GET", "/users/1?x=y", nil)
+	w4 := ut.PerformRequest(handler, "GET", "/other", nil)
+	ut.PerformRequest(handler, "DELETE", "/users/2", nil)
+	assert.NotEqual(t, w1.Body.String(), ut.PerformRequest(handler, "GET", "/users", nil).Body.String())
+	assert.NotEqual(t, w2.Body.String(), ut.PerformRequest(handler, "GET", "/users?page=2", nil).Body.String())
+	assert.NotEqual(t, w3.Body.String(), ut.PerformRequest(handler, "GET", "/users/1?x=y", nil).Body.String())
+	// the paths under the root are not purged
+	assert.DeepEqual(t, w4.Body.String(), ut.PerformRequest(handler, "GET", "/other", nil).Body.String())
+}
+
+func TestInvalidateParentPathExact(t *testing.T) {
+	// the stores without prefix support only drop the parent itself
+	store := &exactStore{CacheStore: persist.NewMemoryStore(1 * time.Minute)}
+	handler := hertzUnsafeHandler(NewCacheByRequestURI(store, 1*time.Minute,
+		WithInvalidateOnUnsafeMethods(true),
+		WithInvalidateParentPath(1)))
+
+	w1 := ut.PerformRequest(handler, "GET", "/users", nil)
+	w2 := ut.PerformRequest(handler, "GET", "/users/1", nil)
+	ut.PerformRequest(handler, "DELETE", "/users/2", nil)
+	assert.NotEqual(t, w1.Body.String(), ut.PerformRequest(handler, "GET", "/users", nil).Body.String())
+	assert.DeepEqual(t, w2.Body.String(), ut.PerformRequest(handler, "GET", "/users/1", nil).Body.String())
+}
+
+// exactStore hides the PrefixDeleter of the wrapped store
+type exactStore struct {
+	persist.CacheStore
+}
+
+func TestInvalidationURIs(t *testing.T) {
+	c := app.NewContext(0)
+	c.Request.SetRequestURI("/a/b/c?x=1")
+	c.Request.SetHost("example.com")
+	c.Response.Header.Set("Location", "d")
+	c.Response.Header.Set("Content-Location", "http://example.com/e?y=2")
+
+	assert.DeepEqual(t, []string{"/a/b/c?x=1", "/a/b/d", "/e?y=2"}, invalidationURIs(c))
+	assert.DeepEqual(t, []string{"/a/b", "/a"}, parentPaths(c, 2))
+	assert.DeepEqual(t, []string{"/a/b", "/a", "/"}, parentPaths(c, 5))
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package cache
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// TTLJitter randomizes the ttl of each stored entry, so that the entries populated
+// at the same moment do not expire in lockstep.
+type TTLJitter struct {
+	// Percent randomizes the ttl within ±Percent of it, e.g. 0.1 for ±10%
+	Percent float64
+
+	// Range randomizes the ttl within ±Range, only used if Percent is zero
+	Range time.Duration
+}
+
+// apply returns the randomized ttl, r is a random number in [0.0, 1.0)
+func (j TTLJitter) apply(ttl time.Duration, r float64) time.Duration {
+	spread := j.Range
+	if j.Percent > 0 {
+		spread = time.Duration(float64(ttl) * j.Percent)
+	}
+	if spread <= 0 {
+		return ttl
+	}
+
+	jittered := ttl + time.Duration((2*r-1)*float64(spread))
+	if jittered <= 0 {
+		return ttl
+	}
+	return jittered
+}
+
+// jitterTTL randomizes the ttl with the jitter of the strategy, or the global one if the strategy has none
+func (o *Options) jitterTTL(ttl time.Duration, strategyJitter *TTLJitter) time.Duration {
+	jitter := o.ttlJitter
+	if strategyJitter != nil {
+		jitter = *strategyJitter
+	}
+	if jitter.Percent <= 0 && jitter.Range <= 0 {
+		return ttl
+	}
+	return jitter.apply(ttl, o.jitterFloat64())
+}
+
+// seededFloat64 returns a concurrency safe random source with the given seed
+func seededFloat64(seed int64) func() float64 {
+	var mu sync.Mutex
+	rnd := rand.New(rand.NewSource(seed))
+	return func() float64 {
+		mu.Lock()
+		defer mu.Unlock()
+		return rnd.Float64()
+	}
+}
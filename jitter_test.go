@@ -0,0 +1,122 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package cache
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/route"
+	"github.com/hertz-contrib/cache/persist"
+)
+
+func TestTTLJitterApply(t *testing.T) {
+	percent := TTLJitter{Percent: 0.1}
+	assert.DeepEqual(t, 90*time.Second, percent.apply(100*time.Second, 0))
+	assert.DeepEqual(t, 100*time.Second, percent.apply(100*time.Second, 0.5))
+	assert.DeepEqual(t, 105*time.Second, percent.apply(100*time.Second, 0.75))
+
+	absolute := TTLJitter{Range: 10 * time.Second}
+	assert.DeepEqual(t, 50*time.Second, absolute.apply(60*time.Second, 0))
+	assert.DeepEqual(t, 65*time.Second, absolute.apply(60*time.Second, 0.75))
+
+	// the jittered ttl never drops to zero
+	assert.DeepEqual(t, time.Second, absolute.apply(time.Second, 0))
+	assert.DeepEqual(t, time.Minute, TTLJitter{}.apply(time.Minute, 0))
+}
+
+func TestTTLJitterSeed(t *testing.T) {
+	first := newOptions(WithTTLJitter(TTLJitter{Percent: 0.2}), WithTTLJitterSeed(42))
+	second := newOptions(WithTTLJitter(TTLJitter{Percent: 0.2}), WithTTLJitterSeed(42))
+
+	spread := false
+	for i := 0; i < 10; i++ {
+		ttl := first.jitterTTL(time.Minute, nil)
+		assert.DeepEqual(t, ttl, second.jitterTTL(time.Minute, nil))
+		assert.True(t, ttl >= 48*time.Second && ttl <= 72*time.Second)
+		spread = spread || ttl != time.Minute
+	}
+	assert.True(t, spread)
+
+	// the jitter of the strategy overrides the global one
+	assert.DeepEqual(t, time.Minute, first.jitterTTL(time.Minute, &TTLJitter{}))
+}
+
+func TestTTLJitter(t *testing.T) {
+	var ttls []time.Duration
+	r := route.NewEngine(config.NewOptions([]config.Option{}))
+	r.Use(NewCache(persist.NewMemoryStore(time.Minute), time.Minute,
+		WithCacheStrategyByRequest(func(ctx context.Context, c *app.RequestContext) (bool, Strategy) {
+			strategy := Strategy{CacheKey: c.Request.URI().String()}
+			if c.Query("jitter") == "off" {
+				strategy.TTLJitter = &TTLJitter{}
+			}
+			return true, strategy
+		}),
+		WithTTLJitter(TTLJitter{Range: 10 * time.Second}),
+		WithTTLJitterSeed(1),
+		WithOnEvent(func(ctx context.Context, c *app.RequestContext, event Event) {
+			if event.Kind == EventSet {
+				ttls = append(ttls, event.TTL)
+			}
+		})))
+	r.GET("/cache", func(ctx context.Context, c *app.RequestContext) {
+		c.String(http.StatusOK, "ok")
+	})
+
+	ut.PerformRequest(r, "GET", "/cache?uid=1", nil)
+	ut.PerformRequest(r, "GET", "/cache?uid=2", nil)
+	ut.PerformRequest(r, "GET", "/cache?jitter=off", nil)
+
+	expected := newOptions(WithTTLJitter(TTLJitter{Range: 10 * time.Second}), WithTTLJitterSeed(1))
+	assert.DeepEqual(t, []time.Duration{
+		expected.jitterTTL(time.Minute, nil),
+		expected.jitterTTL(time.Minute, nil),
+		time.Minute,
+	}, ttls)
+	assert.True(t, ttls[0] != ttls[1])
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package cache
+
+import (
+	"context"
+	"sync"
+
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/cloudwego/hertz/pkg/route"
+	"github.com/hertz-contrib/cache/persist"
+)
+
+const (
+	closeStoreErrorFormat       = "[CACHE] close cache store error: %s, store: %s"
+	closeAsyncWriterErrorFormat = "[CACHE] close async writer error: %s"
+)
+
+var (
+	shutdownHooksMu sync.Mutex
+	// shutdownHooks the ordered shutdown hook of each engine, as the OnShutdown hooks run concurrently
+	shutdownHooks = make(map[*route.Engine]*shutdownHook)
+)
+
+// shutdownHook closes the AsyncWriters, so that their pending writes are flushed, then the stores
+type shutdownHook struct {
+	mu      sync.Mutex
+	writers []*AsyncWriter
+	stores  []persist.CacheStore
+}
+
+// shutdownHookOf returns the ordered shutdown hook of engine, and registers it in the OnShutdown hooks once
+func shutdownHookOf(engine *route.Engine) *shutdownHook {
+	shutdownHooksMu.Lock()
+	defer shutdownHooksMu.Unlock()
+	if hook, ok := shutdownHooks[engine]; ok {
+		return hook
+	}
+
+	hook := &shutdownHook{}
+	shutdownHooks[engine] = hook
+	engine.OnShutdown = append(engine.OnShutdown, func(ctx context.Context) {
+		shutdownHooksMu.Lock()
+		delete(shutdownHooks, engine)
+		shutdownHooksMu.Unlock()
+		hook.run(ctx)
+	})
+	return hook
+}
+
+func (h *shutdownHook) run(ctx context.Context) {
+	h.mu.Lock()
+	writers, stores := h.writers, h.stores
+	h.mu.Unlock()
+
+	for _, writer := range writers {
+		if err := writer.Close(ctx); err != nil {
+			hlog.CtxErrorf(ctx, closeAsyncWriterErrorFormat, err)
+		}
+	}
+	for _, store := range stores {
+		if err := persist.CloseStore(store); err != nil {
+			hlog.CtxErrorf(ctx, closeStoreErrorFormat, err, StoreName(store))
+		}
+	}
+}
+
+// RegisterStoreShutdown closes the stores implementing persist.Closer in the OnShutdown hooks of the engine,
+// so that their goroutines and connections are released, e.g. RegisterStoreShutdown(h.Engine, memoryStore).
+// The stores are closed after the AsyncWriters registered with AsyncWriter.RegisterShutdown on the same engine
+// are flushed, in a single hook, as the hooks of the engine run concurrently.
+func RegisterStoreShutdown(engine *route.Engine, stores ...persist.CacheStore) {
+	hook := shutdownHookOf(engine)
+	hook.mu.Lock()
+	defer hook.mu.Unlock()
+	hook.stores = append(hook.stores, stores...)
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/route"
+	"github.com/hertz-contrib/cache/persist"
+)
+
+type closingStore struct {
+	failingStore
+	closed int
+	err    error
+}
+
+func (s *closingStore) Close() error {
+	s.closed++
+	return s.err
+}
+
+func TestRegisterStoreShutdown(t *testing.T) {
+	memoryStore := persist.NewMemoryStore(time.Minute)
+	failing := &closingStore{err: errors.New("close failed")}
+	wrapped := &closingStore{}
+
+	r := route.NewEngine(config.NewOptions([]config.Option{}))
+	RegisterStoreShutdown(r, memoryStore, failing, persist.NewCircuitBreakerStore(wrapped), failingStore{})
+	assert.DeepEqual(t, 1, len(r.OnShutdown))
+
+	r.OnShutdown[0](context.Background())
+	assert.DeepEqual(t, 1, failing.closed)
+	assert.DeepEqual(t, 1, wrapped.closed)
+	assert.NotNil(t, memoryStore.Set(context.Background(), "key", "value", time.Minute))
+	assert.Nil(t, memoryStore.Close())
+}
+
+func TestRegisterStoreShutdownAsyncWriter(t *testing.T) {
+	store := &blockingStore{MemoryStore: persist.NewMemoryStore(time.Minute), release: make(chan struct{})}
+	writer := NewAsyncWriter(1, 1, OverflowDrop)
+	assert.Nil(t, writer.submit(context.Background(), func(ctx context.Context) error {
+		return store.Set(ctx, "key", "value", time.Minute)
+	}))
+
+	// the hooks registered separately are run in order in a single hook
+	r := route.NewEngine(config.NewOptions([]config.Option{}))
+	RegisterStoreShutdown(r, store)
+	writer.RegisterShutdown(r)
+	assert.DeepEqual(t, 1, len(r.OnShutdown))
+	time.AfterFunc(50*time.Millisecond, func() {
+		close(store.release)
+	})
+
+	// the pending write lands before the store is closed
+	r.OnShutdown[0](context.Background())
+	assert.DeepEqual(t, uint64(1), writer.Stats().Written)
+	assert.NotNil(t, store.MemoryStore.Set(context.Background(), "key", "value", time.Minute))
+}
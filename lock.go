@@ -0,0 +1,125 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/hertz-contrib/cache/persist"
+)
+
+const (
+	obtainLockErrorFormat  = "[CACHE] obtain lock error: %s, cache key: %s"
+	releaseLockErrorFormat = "[CACHE] release lock error: %s, cache key: %s"
+	lockWaitTimeoutFormat  = "[CACHE] wait for lock timeout, cache key: %s"
+	staleLockWriteFormat   = "[CACHE] lock expired before the write, cache key: %s"
+)
+
+const (
+	defaultLockTTL          = 10 * time.Second
+	defaultLockWaitTimeout  = 3 * time.Second
+	defaultLockPollInterval = 50 * time.Millisecond
+)
+
+// obtainLockOrWait obtains the distributed lock of the cache key. If the lock is held by another instance,
+// it polls the store until the response of the holder appears, or obtains the lock once the holder
+// released it or crashed and the lock expired. Both results are nil if the locker fails or the wait
+// timeout is reached, then the backend is called without the lock.
+func obtainLockOrWait(
+	ctx context.Context,
+	options *Options,
+	cacheStore persist.CacheStore,
+	cacheKey string,
+) (persist.Lock, *ResponseCache) {
+	lock, err := options.locker.Obtain(ctx, cacheKey, options.lockTTL)
+	if err == nil {
+		return lock, nil
+	}
+	if !errors.Is(err, persist.ErrLockNotObtained) {
+		hlog.CtxErrorf(ctx, obtainLockErrorFormat, err, cacheKey)
+		return nil, nil
+	}
+
+	timeout := time.NewTimer(options.lockWaitTimeout)
+	defer timeout.Stop()
+	ticker := time.NewTicker(options.lockPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, nil
+		case <-timeout.C:
+			hlog.CtxWarnf(ctx, lockWaitTimeoutFormat, cacheKey)
+			return nil, nil
+		case <-ticker.C:
+		}
+
+		respCache := &ResponseCache{}
+		getCtx, cancel := options.readContext(ctx)
+		err := cacheStore.Get(getCtx, cacheKey, &respCache)
+		cancel()
+		if err == nil {
+			return nil, respCache
+		}
+
+		lock, err := options.locker.Obtain(ctx, cacheKey, options.lockTTL)
+		if err == nil {
+			return lock, nil
+		}
+		if !errors.Is(err, persist.ErrLockNotObtained) {
+			hlog.CtxErrorf(ctx, obtainLockErrorFormat, err, cacheKey)
+			return nil, nil
+		}
+	}
+}
+
+// releaseLock releases the lock even if the request has been cancelled
+func releaseLock(ctx context.Context, options *Options, lock persist.Lock, cacheKey string) {
+	releaseCtx, cancel := withTimeout(detachedContext{parent: ctx}, options.storeWriteTimeout)
+	defer cancel()
+	if err := lock.Release(releaseCtx); err != nil {
+		hlog.CtxErrorf(ctx, releaseLockErrorFormat, err, cacheKey)
+	}
+}
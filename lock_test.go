@@ -0,0 +1,247 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package cache
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/route"
+	"github.com/hertz-contrib/cache/persist"
+)
+
+// memoryLocker is an in-process Locker simulating the lock shared by instances
+type memoryLocker struct {
+	mu     sync.Mutex
+	locks  map[string]*memoryLock
+	tokens int64
+}
+
+type memoryLock struct {
+	locker *memoryLocker
+	key    string
+	token  int64
+}
+
+func (l *memoryLocker) Obtain(ctx context.Context, key string, ttl time.Duration) (persist.Lock, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.locks == nil {
+		l.locks = make(map[string]*memoryLock)
+	}
+	if _, ok := l.locks[key]; ok {
+		return nil, persist.ErrLockNotObtained
+	}
+	l.tokens++
+	lock := &memoryLock{locker: l, key: key, token: l.tokens}
+	l.locks[key] = lock
+	return lock, nil
+}
+
+func (l *memoryLock) Token() int64 {
+	return l.token
+}
+
+func (l *memoryLock) Release(ctx context.Context) error {
+	l.locker.mu.Lock()
+	defer l.locker.mu.Unlock()
+	if l.locker.locks[l.key] == l {
+		delete(l.locker.locks, l.key)
+	}
+	return nil
+}
+
+// tokenStore records the fencing token of the writes
+type tokenStore struct {
+	*persist.MemoryStore
+	token int64
+}
+
+func (s *tokenStore) Set(ctx context.Context, key string, value interface{}, expire time.Duration) error {
+	s.token, _ = persist.LockToken(ctx)
+	return s.MemoryStore.Set(ctx, key, value, expire)
+}
+
+func lockHandler(middleware app.HandlerFunc, backendCount *int32) *route.Engine {
+	r := route.NewEngine(config.NewOptions([]config.Option{}))
+	r.Use(middleware)
+	r.GET("/cache", func(ctx context.Context, c *app.RequestContext) {
+		atomic.AddInt32(backendCount, 1)
+		c.String(http.StatusOK, "backend")
+	})
+	return r
+}
+
+func TestDistributedLock(t *testing.T) {
+	var backendCount int32
+	locker := &memoryLocker{}
+	store := &tokenStore{MemoryStore: persist.NewMemoryStore(time.Minute)}
+	handler := lockHandler(NewCacheByRequestURI(store, time.Minute,
+		WithDistributedLock(locker, time.Second, time.Second),
+		WithLockPollInterval(10*time.Millisecond)), &backendCount)
+
+	w := ut.PerformRequest(handler, "GET", "/cache", nil)
+	assert.DeepEqual(t, "backend", w.Body.String())
+	assert.DeepEqual(t, int32(1), backendCount)
+	assert.DeepEqual(t, int64(1), store.token)
+	assert.DeepEqual(t, 0, len(locker.locks))
+}
+
+func TestDistributedLockWaitForHolder(t *testing.T) {
+	var backendCount int32
+	locker := &memoryLocker{}
+	store := persist.NewMemoryStore(time.Minute)
+	handler := lockHandler(NewCacheByRequestURI(store, time.Minute,
+		WithDistributedLock(locker, time.Second, time.Second),
+		WithLockPollInterval(10*time.Millisecond)), &backendCount)
+
+	// another instance holds the lock and stores its response later
+	lock, err := locker.Obtain(context.Background(), "/cache", time.Second)
+	assert.Nil(t, err)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = store.Set(context.Background(), "/cache", &ResponseCache{Status: http.StatusOK, Data: []byte("holder")}, time.Minute)
+		_ = lock.Release(context.Background())
+	}()
+
+	w := ut.PerformRequest(handler, "GET", "/cache", nil)
+	assert.DeepEqual(t, "holder", w.Body.String())
+	assert.DeepEqual(t, int32(0), backendCount)
+}
+
+func TestDistributedLockHolderCrashed(t *testing.T) {
+	var backendCount int32
+	locker := &memoryLocker{}
+	store := persist.NewMemoryStore(time.Minute)
+	handler := lockHandler(NewCacheByRequestURI(store, time.Minute,
+		WithDistributedLock(locker, time.Second, time.Second),
+		WithLockPollInterval(10*time.Millisecond)), &backendCount)
+
+	// the holder crashed without storing, its lock expires
+	lock, err := locker.Obtain(context.Background(), "/cache", time.Second)
+	assert.Nil(t, err)
+	time.AfterFunc(30*time.Millisecond, func() {
+		_ = lock.Release(context.Background())
+	})
+
+	w := ut.PerformRequest(handler, "GET", "/cache", nil)
+	assert.DeepEqual(t, "backend", w.Body.String())
+	assert.DeepEqual(t, int32(1), backendCount)
+}
+
+func TestDistributedLockWaitTimeout(t *testing.T) {
+	var backendCount int32
+	locker := &memoryLocker{}
+	handler := lockHandler(NewCacheByRequestURI(persist.NewMemoryStore(time.Minute), time.Minute,
+		WithDistributedLock(locker, time.Second, 30*time.Millisecond),
+		WithLockPollInterval(10*time.Millisecond)), &backendCount)
+
+	_, err := locker.Obtain(context.Background(), "/cache", time.Second)
+	assert.Nil(t, err)
+
+	w := ut.PerformRequest(handler, "GET", "/cache", nil)
+	assert.DeepEqual(t, "backend", w.Body.String())
+	assert.DeepEqual(t, int32(1), backendCount)
+}
+
+// blockingStore blocks the writes until release is closed
+type blockingStore struct {
+	*persist.MemoryStore
+	release chan struct{}
+}
+
+func (s *blockingStore) Set(ctx context.Context, key string, value interface{}, expire time.Duration) error {
+	<-s.release
+	return s.MemoryStore.Set(ctx, key, value, expire)
+}
+
+func TestDistributedLockAsyncWriter(t *testing.T) {
+	var backendCount int32
+	locker := &memoryLocker{}
+	store := &blockingStore{MemoryStore: persist.NewMemoryStore(time.Minute), release: make(chan struct{})}
+	writer := NewAsyncWriter(1, 1, OverflowDrop)
+	handler := lockHandler(NewCacheByRequestURI(store, time.Minute,
+		WithDistributedLock(locker, time.Second, time.Second),
+		WithAsyncWriter(writer)), &backendCount)
+
+	w := ut.PerformRequest(handler, "GET", "/cache", nil)
+	assert.DeepEqual(t, "backend", w.Body.String())
+
+	// the lock is held until the queued write lands, so that the other instances wait for it
+	locker.mu.Lock()
+	assert.DeepEqual(t, 1, len(locker.locks))
+	locker.mu.Unlock()
+
+	close(store.release)
+	assert.Nil(t, writer.Close(context.Background()))
+	assert.DeepEqual(t, 0, len(locker.locks))
+}
+
+func TestDistributedLockNonPositiveDurations(t *testing.T) {
+	options := newOptions(WithDistributedLock(&memoryLocker{}, 0, -time.Second), WithLockPollInterval(0))
+	assert.DeepEqual(t, defaultLockTTL, options.lockTTL)
+	assert.DeepEqual(t, defaultLockWaitTimeout, options.lockWaitTimeout)
+	assert.DeepEqual(t, defaultLockPollInterval, options.lockPollInterval)
+
+	// a contended request polls with the default interval instead of panicking
+	var backendCount int32
+	locker := &memoryLocker{}
+	store := persist.NewMemoryStore(time.Minute)
+	handler := lockHandler(NewCacheByRequestURI(store, time.Minute,
+		WithDistributedLock(locker, time.Second, time.Second),
+		WithLockPollInterval(0)), &backendCount)
+	lock, err := locker.Obtain(context.Background(), "/cache", time.Second)
+	assert.Nil(t, err)
+	time.AfterFunc(30*time.Millisecond, func() {
+		_ = lock.Release(context.Background())
+	})
+
+	w := ut.PerformRequest(handler, "GET", "/cache", nil)
+	assert.DeepEqual(t, "backend", w.Body.String())
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package cache
+
+import (
+	"reflect"
+	"time"
+
+	"github.com/hertz-contrib/cache/persist"
+)
+
+// BypassReason describes why a request is passed through without caching
+type BypassReason string
+
+const (
+	// BypassReasonStrategy the cache strategy decided not to cache the request
+	BypassReasonStrategy BypassReason = "strategy"
+	// BypassReasonUnsafeMethod the request is an unsafe method which invalidates the cache
+	BypassReasonUnsafeMethod BypassReason = "unsafe_method"
+)
+
+const (
+	storeOpGet    = "get"
+	storeOpSet    = "set"
+	storeOpDelete = "delete"
+)
+
+// MetricsLabels the labels attached to every cache metric
+type MetricsLabels struct {
+	// Route the full path of the matched route
+	Route string
+	// Store the name of the cache store, see StoreName
+	Store string
+}
+
+// MetricsRecorder records the cache metrics. Implementations must be safe for concurrent use.
+type MetricsRecorder interface {
+	// IncHit is called when the response is replied from the cache store
+	IncHit(labels MetricsLabels)
+	// IncMiss is called when the cache store does not have the response
+	IncMiss(labels MetricsLabels)
+	// IncShared is called when the response is shared from another in-flight request
+	IncShared(labels MetricsLabels)
+	// IncBypass is called when the request is passed through without caching
+	IncBypass(labels MetricsLabels, reason BypassReason)
+	// IncStoreError is called when the cache store operation ("get" or "set") fails
+	IncStoreError(labels MetricsLabels, op string)
+	// ObserveStoreLatency is called after every cache store operation ("get" or "set")
+	ObserveStoreLatency(labels MetricsLabels, op string, latency time.Duration)
+	// AddStoredBytes is called with the body size after a response is stored
+	AddStoredBytes(labels MetricsLabels, n int)
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) IncHit(MetricsLabels)                                     {}
+func (noopMetrics) IncMiss(MetricsLabels)                                    {}
+func (noopMetrics) IncShared(MetricsLabels)                                  {}
+func (noopMetrics) IncBypass(MetricsLabels, BypassReason)                    {}
+func (noopMetrics) IncStoreError(MetricsLabels, string)                      {}
+func (noopMetrics) ObserveStoreLatency(MetricsLabels, string, time.Duration) {}
+func (noopMetrics) AddStoredBytes(MetricsLabels, int)                        {}
+
+// StoreName returns the name of the cache store used in metrics.
+// Stores can customize it by implementing `Name() string`, otherwise the type name is used.
+func StoreName(store persist.CacheStore) string {
+	if named, ok := store.(interface{ Name() string }); ok {
+		return named.Name()
+	}
+
+	t := reflect.TypeOf(store)
+	if t == nil {
+		return ""
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
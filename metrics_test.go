@@ -0,0 +1,92 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/hertz-contrib/cache/persist"
+)
+
+type namedStore struct {
+	*persist.MemoryStore
+}
+
+func (s *namedStore) Name() string {
+	return "named"
+}
+
+func TestStoreName(t *testing.T) {
+	memoryStore := persist.NewMemoryStore(1 * time.Minute)
+	assert.DeepEqual(t, "MemoryStore", StoreName(memoryStore))
+	assert.DeepEqual(t, "named", StoreName(&namedStore{memoryStore}))
+	assert.DeepEqual(t, "", StoreName(nil))
+}
+
+type bypassCountMetrics struct {
+	noopMetrics
+	count int32
+}
+
+func (m *bypassCountMetrics) IncBypass(labels MetricsLabels, reason BypassReason) {
+	atomic.AddInt32(&m.count, 1)
+}
+
+func TestMetricsBypass(t *testing.T) {
+	metrics := &bypassCountMetrics{}
+	memoryStore := persist.NewMemoryStore(1 * time.Minute)
+	handler := hertzHandler(NewCache(memoryStore, 1*time.Minute,
+		WithMetrics(metrics),
+		WithCacheStrategyByRequest(func(ctx context.Context, c *app.RequestContext) (bool, Strategy) {
+			return false, Strategy{}
+		}),
+	), true)
+
+	ut.PerformRequest(handler, "GET", "/cache", nil)
+	ut.PerformRequest(handler, "GET", "/cache", nil)
+	assert.DeepEqual(t, int32(2), metrics.count)
+}
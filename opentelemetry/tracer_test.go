@@ -0,0 +1,104 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package opentelemetry
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/route"
+	"github.com/hertz-contrib/cache"
+	"github.com/hertz-contrib/cache/persist"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func spanAttr(span sdktrace.ReadOnlySpan, key string) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if string(kv.Key) == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTracer(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	r := route.NewEngine(config.NewOptions([]config.Option{}))
+	r.Use(cache.NewCacheByRequestURI(persist.NewMemoryStore(time.Minute), time.Minute,
+		cache.WithTracer(NewTracer(provider))))
+	r.GET("/cache", func(ctx context.Context, c *app.RequestContext) {
+		c.String(http.StatusOK, "value")
+	})
+
+	ut.PerformRequest(r, "GET", "/cache", nil)
+	ut.PerformRequest(r, "GET", "/cache", nil)
+
+	spans := recorder.Ended()
+	names := make([]string, 0, len(spans))
+	for _, span := range spans {
+		names = append(names, span.Name())
+	}
+	assert.DeepEqual(t, []string{
+		cache.SpanNameLookup,
+		cache.SpanNameHandler,
+		cache.SpanNameStore,
+		cache.SpanNameSingleFlight,
+		cache.SpanNameLookup,
+	}, names)
+
+	assert.DeepEqual(t, cache.OutcomeMiss, spanAttr(spans[0], cache.AttrOutcome).AsString())
+	assert.DeepEqual(t, "MemoryStore", spanAttr(spans[0], cache.AttrStore).AsString())
+	assert.DeepEqual(t, int64(5), spanAttr(spans[2], cache.AttrPayloadSize).AsInt64())
+	assert.DeepEqual(t, spans[3].SpanContext().SpanID(), spans[1].Parent().SpanID())
+	assert.DeepEqual(t, cache.OutcomeLeader, spanAttr(spans[3], cache.AttrOutcome).AsString())
+	assert.DeepEqual(t, cache.OutcomeHit, spanAttr(spans[4], cache.AttrOutcome).AsString())
+	assert.DeepEqual(t, spanAttr(spans[0], cache.AttrKeyHash), spanAttr(spans[4], cache.AttrKeyHash))
+}
@@ -42,9 +42,11 @@ package cache
 
 import (
 	"context"
+	"math/rand"
 	"time"
 
 	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/hertz-contrib/cache/persist"
 )
 
 // Options contains all options
@@ -61,6 +63,36 @@ type Options struct {
 
 	prefixKey     string
 	withoutHeader bool
+
+	invalidateOnUnsafeMethods bool
+	invalidateKeyStrategy     KeyStrategy
+	invalidateParentDepth     int
+
+	metrics MetricsRecorder
+	tracer  Tracer
+
+	eventCallback OnEventCallback
+
+	storeErrorCallback   OnStoreErrorCallback
+	storeErrorPolicyFunc StoreErrorPolicyFunc
+	storeBypassDuration  time.Duration
+
+	storeReadTimeout  time.Duration
+	storeWriteTimeout time.Duration
+	detachedWrite     bool
+
+	asyncWriter *AsyncWriter
+
+	locker           persist.Locker
+	lockTTL          time.Duration
+	lockWaitTimeout  time.Duration
+	lockPollInterval time.Duration
+
+	earlyExpirationBeta float64
+	randFloat64         func() float64
+
+	ttlJitter     TTLJitter
+	jitterFloat64 func() float64
 }
 
 // OnHitCacheCallback define the callback when use cache
@@ -90,6 +122,17 @@ func newOptions(opts ...Option) *Options {
 		missCacheCallback:            defaultMissCacheCallback,
 		beforeReplyWithCacheCallback: defaultBeforeReplyWithCacheCallback,
 		shareSingleFlightCallback:    defaultShareSingleFlightCallback,
+		metrics:                      noopMetrics{},
+		tracer:                       noopTracer{},
+		eventCallback:                defaultEventCallback,
+		storeErrorCallback:           defaultStoreErrorCallback,
+		storeErrorPolicyFunc:         defaultStoreErrorPolicyFunc,
+		storeBypassDuration:          defaultStoreBypassDuration,
+		lockTTL:                      defaultLockTTL,
+		lockWaitTimeout:              defaultLockWaitTimeout,
+		lockPollInterval:             defaultLockPollInterval,
+		randFloat64:                  rand.Float64,
+		jitterFloat64:                rand.Float64,
 	}
 
 	options.Apply(opts)
@@ -111,6 +154,16 @@ func WithCacheStrategyByRequest(getGetCacheStrategyByRequest GetCacheStrategyByR
 	}
 }
 
+// WithOnEvent will be called for every cache event, see EventKind.
+// The hit, miss, share singleflight and store error callbacks are called before it for the corresponding events.
+func WithOnEvent(cb OnEventCallback) Option {
+	return Option{
+		F: func(o *Options) {
+			o.eventCallback = cb
+		},
+	}
+}
+
 // WithOnHitCache will be called when cache hit.
 func WithOnHitCache(cb OnHitCacheCallback) Option {
 	return Option{
@@ -120,7 +173,7 @@ func WithOnHitCache(cb OnHitCacheCallback) Option {
 	}
 }
 
-// WithOnMissCache will be called when cache miss.
+// WithOnMissCache will be called when cache miss, including the refresh of an entry expiring early, see WithEarlyExpiration.
 func WithOnMissCache(cb OnMissCacheCallback) Option {
 	return Option{
 		F: func(o *Options) {
@@ -177,3 +230,200 @@ func WithoutHeader(b bool) Option {
 		},
 	}
 }
+
+// WithInvalidateOnUnsafeMethods enables invalidation on unsafe methods, see RFC 9111 §4.4.
+// A successful POST, PUT, PATCH or DELETE request is passed through without caching, then the cached
+// GET responses of the request URI and its Location and Content-Location targets are deleted.
+func WithInvalidateOnUnsafeMethods(b bool) Option {
+	return Option{
+		F: func(o *Options) {
+			o.invalidateOnUnsafeMethods = b
+		},
+	}
+}
+
+// WithInvalidateKeyStrategy set up the KeyStrategy used to compute the invalidated cache keys.
+// NewCacheByKeyStrategy uses its own strategy by default, otherwise ByURI is used.
+func WithInvalidateKeyStrategy(strategy KeyStrategy) Option {
+	return Option{
+		F: func(o *Options) {
+			o.invalidateKeyStrategy = strategy
+		},
+	}
+}
+
+// WithInvalidateParentPath also invalidates up to depth parent paths of the request path with their cached
+// query string variants and the cached paths under them, e.g. a DELETE /users/1 with depth 1 also purges
+// the cached /users, /users?page=2 and /users/2. The paths under the root are never purged.
+// The variants and the paths under a parent are only purged from the stores implementing persist.PrefixDeleter.
+func WithInvalidateParentPath(depth int) Option {
+	return Option{
+		F: func(o *Options) {
+			o.invalidateParentDepth = depth
+		},
+	}
+}
+
+// WithMetrics set up the MetricsRecorder, e.g. a PrometheusMetrics
+func WithMetrics(metrics MetricsRecorder) Option {
+	return Option{
+		F: func(o *Options) {
+			o.metrics = metrics
+		},
+	}
+}
+
+// WithTracer set up the Tracer to wrap the cache operations in spans
+func WithTracer(tracer Tracer) Option {
+	return Option{
+		F: func(o *Options) {
+			o.tracer = tracer
+		},
+	}
+}
+
+// WithOnStoreError will be called when a cache store operation fails.
+func WithOnStoreError(cb OnStoreErrorCallback) Option {
+	return Option{
+		F: func(o *Options) {
+			o.storeErrorCallback = cb
+		},
+	}
+}
+
+// WithStoreErrorPolicy set up the policy for every failed cache store operation, default is StoreErrorPolicyFailOpen
+func WithStoreErrorPolicy(policy StoreErrorPolicy) Option {
+	return Option{
+		F: func(o *Options) {
+			o.storeErrorPolicyFunc = func(op string, err error) StoreErrorPolicy {
+				return policy
+			}
+		},
+	}
+}
+
+// WithStoreErrorPolicyFunc decides the policy by the failed operation and error,
+// e.g. bypass the store on persist.ErrConnection and fail open otherwise.
+func WithStoreErrorPolicyFunc(fn StoreErrorPolicyFunc) Option {
+	return Option{
+		F: func(o *Options) {
+			o.storeErrorPolicyFunc = fn
+		},
+	}
+}
+
+// WithStoreBypassDuration set up the time to skip a failed store with StoreErrorPolicyBypass
+func WithStoreBypassDuration(d time.Duration) Option {
+	return Option{
+		F: func(o *Options) {
+			o.storeBypassDuration = d
+		},
+	}
+}
+
+// WithStoreReadTimeout set up the timeout of CacheStore.Get, independent of the request deadline
+func WithStoreReadTimeout(timeout time.Duration) Option {
+	return Option{
+		F: func(o *Options) {
+			o.storeReadTimeout = timeout
+		},
+	}
+}
+
+// WithStoreWriteTimeout set up the timeout of CacheStore.Set and CacheStore.Delete
+func WithStoreWriteTimeout(timeout time.Duration) Option {
+	return Option{
+		F: func(o *Options) {
+			o.storeWriteTimeout = timeout
+		},
+	}
+}
+
+// WithDetachedWrite detaches the writes from the cancellation and deadline of the request,
+// so that a completed handler result is still stored after the client went away.
+// It should be used together with WithStoreWriteTimeout to bound the writes.
+func WithDetachedWrite(b bool) Option {
+	return Option{
+		F: func(o *Options) {
+			o.detachedWrite = b
+		},
+	}
+}
+
+// WithAsyncWriter writes the responses to the cache store asynchronously with the AsyncWriter.
+// The set and store error events are not emitted for asynchronous writes since the request
+// may have finished, use the metrics or AsyncWriter.Stats instead.
+func WithAsyncWriter(w *AsyncWriter) Option {
+	return Option{
+		F: func(o *Options) {
+			o.asyncWriter = w
+		},
+	}
+}
+
+// WithDistributedLock coalesces the backend calls of a key across instances with the locker.
+// The lock expires after ttl so that a crashed holder does not block the key, the other instances
+// poll the store for the result of the holder for at most waitTimeout, then call the backend anyway.
+// The lock is released once the response is stored, also with WithAsyncWriter. The writes of a holder
+// whose lock expired are rejected by the stores enforcing the fencing token, e.g. RedisStore with RedisLocker.
+// The non-positive ttl and waitTimeout fall back to the defaults, 10s and 3s.
+func WithDistributedLock(locker persist.Locker, ttl, waitTimeout time.Duration) Option {
+	return Option{
+		F: func(o *Options) {
+			o.locker = locker
+			o.lockTTL = ttl
+			if ttl <= 0 {
+				o.lockTTL = defaultLockTTL
+			}
+			o.lockWaitTimeout = waitTimeout
+			if waitTimeout <= 0 {
+				o.lockWaitTimeout = defaultLockWaitTimeout
+			}
+		},
+	}
+}
+
+// WithLockPollInterval set up the interval to poll the store while waiting for the lock holder,
+// default is 50ms which is also used for a non-positive interval
+func WithLockPollInterval(interval time.Duration) Option {
+	return Option{
+		F: func(o *Options) {
+			o.lockPollInterval = interval
+			if interval <= 0 {
+				o.lockPollInterval = defaultLockPollInterval
+			}
+		},
+	}
+}
+
+// WithEarlyExpiration set up the probabilistic early expiration (XFetch) of the cached responses,
+// a lookup treats the entry as expired slightly before its expiration, with a probability growing
+// as the expiration approaches and with the time taken by the backend to generate the response.
+// Only the request refreshing the entry calls the backend, the others still hit the cache.
+// beta scales the earliness, 1.0 is the usual choice, and 0 disables it.
+func WithEarlyExpiration(beta float64) Option {
+	return Option{
+		F: func(o *Options) {
+			o.earlyExpirationBeta = beta
+		},
+	}
+}
+
+// WithTTLJitter set up the jitter randomizing the ttl of each stored entry,
+// it can be overridden by Strategy.TTLJitter
+func WithTTLJitter(jitter TTLJitter) Option {
+	return Option{
+		F: func(o *Options) {
+			o.ttlJitter = jitter
+		},
+	}
+}
+
+// WithTTLJitterSeed set up the seed of the ttl jitter, making the randomized ttl deterministic
+func WithTTLJitterSeed(seed int64) Option {
+	return Option{
+		F: func(o *Options) {
+			o.jitterFloat64 = seededFloat64(seed)
+		},
+	}
+}
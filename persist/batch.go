@@ -0,0 +1,128 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package persist
+
+import (
+	"context"
+	"time"
+)
+
+// BatchStore is implemented by the stores reading, writing or removing several items at once, e.g. in one round trip.
+// GetMulti, SetMulti and DeleteMulti fall back to the per-key calls for the stores not implementing it.
+type BatchStore interface {
+	// GetMulti retrieves the items of keys into values, which must have the same length as keys.
+	// The returned errors are in the order of keys, ErrCacheMiss for the keys not in the store.
+	GetMulti(ctx context.Context, keys []string, values []interface{}) []error
+
+	// SetMulti sets the items to the Cache, replacing any existing item.
+	SetMulti(ctx context.Context, items map[string]interface{}, expire time.Duration) error
+
+	// DeleteMulti removes the items of keys from the Cache. Does nothing for the keys not in the Cache.
+	DeleteMulti(ctx context.Context, keys []string) error
+}
+
+// GetMulti retrieves the items of keys into values, which must have the same length as keys, from store.
+// The returned errors are in the order of keys, ErrCacheMiss for the keys not in the store.
+func GetMulti(ctx context.Context, store CacheStore, keys []string, values []interface{}) []error {
+	if len(keys) != len(values) {
+		panic("persist: GetMulti called with different numbers of keys and values")
+	}
+	if batch, ok := store.(BatchStore); ok {
+		return batch.GetMulti(ctx, keys, values)
+	}
+	return getEach(ctx, store, keys, values)
+}
+
+// SetMulti sets the items to store, the remaining items are still set after a failure and the first error is returned
+func SetMulti(ctx context.Context, store CacheStore, items map[string]interface{}, expire time.Duration) error {
+	if batch, ok := store.(BatchStore); ok {
+		return batch.SetMulti(ctx, items, expire)
+	}
+	return setEach(ctx, store, items, expire)
+}
+
+// DeleteMulti removes the items of keys from store, the remaining keys are still removed after a failure
+// and the first error is returned
+func DeleteMulti(ctx context.Context, store CacheStore, keys []string) error {
+	if batch, ok := store.(BatchStore); ok {
+		return batch.DeleteMulti(ctx, keys)
+	}
+	return deleteEach(ctx, store, keys)
+}
+
+// getEach retrieves the items of keys with one Get per key
+func getEach(ctx context.Context, store CacheStore, keys []string, values []interface{}) []error {
+	errs := make([]error, len(keys))
+	for i, key := range keys {
+		errs[i] = store.Get(ctx, key, values[i])
+	}
+	return errs
+}
+
+// setEach sets the items with one Set per item, and returns the first error
+func setEach(ctx context.Context, store CacheStore, items map[string]interface{}, expire time.Duration) error {
+	var firstErr error
+	for key, value := range items {
+		if err := store.Set(ctx, key, value, expire); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// deleteEach removes the items of keys with one Delete per key, and returns the first error
+func deleteEach(ctx context.Context, store CacheStore, keys []string) error {
+	var firstErr error
+	for _, key := range keys {
+		if err := store.Delete(ctx, key); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// fillErrors sets all the errs to err, which failed the whole batch
+func fillErrors(errs []error, err error) []error {
+	for i := range errs {
+		errs[i] = err
+	}
+	return errs
+}
@@ -0,0 +1,149 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package persist
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/go-redis/redis/v8"
+)
+
+// unbatchedStore hides the batch operations of the wrapped store
+type unbatchedStore struct {
+	CacheStore
+}
+
+func testBatchStore(t *testing.T, store CacheStore) {
+	ctx := context.Background()
+
+	assert.Nil(t, SetMulti(ctx, store, map[string]interface{}{
+		"batch-a": "a",
+		"batch-b": "b",
+	}, time.Minute))
+
+	var a, b, c string
+	errs := GetMulti(ctx, store, []string{"batch-a", "batch-c", "batch-b"}, []interface{}{&a, &c, &b})
+	assert.DeepEqual(t, 3, len(errs))
+	assert.Nil(t, errs[0])
+	assert.DeepEqual(t, ErrCacheMiss, errs[1])
+	assert.Nil(t, errs[2])
+	assert.DeepEqual(t, "a", a)
+	assert.DeepEqual(t, "b", b)
+
+	assert.Nil(t, DeleteMulti(ctx, store, []string{"batch-a", "batch-b", "batch-c"}))
+	errs = GetMulti(ctx, store, []string{"batch-a", "batch-b"}, []interface{}{&a, &b})
+	assert.DeepEqual(t, ErrCacheMiss, errs[0])
+	assert.DeepEqual(t, ErrCacheMiss, errs[1])
+
+	assert.DeepEqual(t, 0, len(GetMulti(ctx, store, nil, nil)))
+	assert.Nil(t, SetMulti(ctx, store, nil, time.Minute))
+	assert.Nil(t, DeleteMulti(ctx, store, nil))
+}
+
+func TestBatchMemoryStore(t *testing.T) {
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+
+	var _ BatchStore = store
+	testBatchStore(t, store)
+}
+
+func TestBatchRedisStore(t *testing.T) {
+	store := NewRedisStore(redis.NewClient(&redis.Options{
+		Addr: "127.0.0.1:6379",
+	}))
+	defer store.Close()
+
+	var _ BatchStore = store
+	testBatchStore(t, store)
+}
+
+func TestBatchRedisStoreClusterClient(t *testing.T) {
+	store := NewRedisStore(redis.NewClusterClient(&redis.ClusterOptions{
+		Addrs: []string{"127.0.0.1:6379"},
+	}))
+	defer store.Close()
+
+	testBatchStore(t, store)
+}
+
+func TestBatchFallback(t *testing.T) {
+	store := NewMemoryStore(time.Minute)
+	defer store.Close()
+
+	testBatchStore(t, unbatchedStore{CacheStore: store})
+}
+
+func TestBatchErrors(t *testing.T) {
+	ctx := context.Background()
+	store := NewRedisStore(redis.NewClient(&redis.Options{
+		Addr: "127.0.0.1:6379",
+	}))
+	defer store.Close()
+
+	// a serialization failure does not prevent setting the other items
+	err := SetMulti(ctx, store, map[string]interface{}{
+		"batch-func":  func() {},
+		"batch-valid": "valid",
+	}, time.Minute)
+	assert.True(t, errors.Is(err, ErrSerialization))
+
+	var valid string
+	var number int
+	errs := GetMulti(ctx, store, []string{"batch-valid", "batch-valid"}, []interface{}{&valid, &number})
+	assert.Nil(t, errs[0])
+	assert.DeepEqual(t, "valid", valid)
+	assert.NotNil(t, errs[1])
+	assert.Nil(t, store.Delete(ctx, "batch-valid"))
+
+	// a connection failure fails all the keys
+	closed := NewRedisStore(redis.NewClient(&redis.Options{
+		Addr: "127.0.0.1:6379",
+	}))
+	closed.Close()
+	errs = GetMulti(ctx, closed, []string{"batch-a", "batch-b"}, []interface{}{&valid, &valid})
+	assert.NotNil(t, errs[0])
+	assert.DeepEqual(t, errs[0], errs[1])
+}
@@ -46,6 +46,15 @@ import (
 	"time"
 )
 
+// the names of the store operations
+const (
+	opGet    = "get"
+	opSet    = "set"
+	opDelete = "delete"
+	opLock   = "lock"
+	opUnlock = "unlock"
+)
+
 // ErrCacheMiss represent the cache key does not exist in the store
 var ErrCacheMiss = errors.New("persist cache miss error")
 
@@ -60,3 +69,17 @@ type CacheStore interface {
 	// Delete removes an item from the Cache. Does nothing if the key is not in the Cache.
 	Delete(ctx context.Context, key string) error
 }
+
+// Closer is implemented by the stores holding resources, e.g. background goroutines or connections,
+// which are released by Close. The store must not be used after Close.
+type Closer interface {
+	Close() error
+}
+
+// CloseStore closes store if it implements Closer, otherwise does nothing
+func CloseStore(store CacheStore) error {
+	if closer, ok := store.(Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
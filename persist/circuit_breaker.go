@@ -0,0 +1,386 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package persist
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// CircuitState the state of the CircuitBreakerStore
+type CircuitState int32
+
+const (
+	// CircuitClosed the calls are passed to the store
+	CircuitClosed CircuitState = iota
+	// CircuitOpen the calls are short-circuited, Get returns ErrCacheMiss and writes do nothing
+	CircuitOpen
+	// CircuitHalfOpen a limited number of probe calls are passed to the store
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// CircuitBreakerOptions contains the options of CircuitBreakerStore
+type CircuitBreakerOptions struct {
+	// ErrorRateThreshold opens the circuit when the rate of failed calls reaches it
+	ErrorRateThreshold float64
+	// SlowCallDuration the calls taking longer are considered slow, zero disables the latency threshold
+	SlowCallDuration time.Duration
+	// SlowCallRateThreshold opens the circuit when the rate of slow calls reaches it
+	SlowCallRateThreshold float64
+	// MinRequests the minimum number of calls in a window before the rates are evaluated
+	MinRequests int
+	// Window the length of the fixed window the calls are counted in
+	Window time.Duration
+	// OpenTimeout the time to stay open before probing the store
+	OpenTimeout time.Duration
+	// HalfOpenProbes the number of successful probes required to close the circuit
+	HalfOpenProbes int
+	// OnStateChange will be called when the state changes
+	OnStateChange func(from, to CircuitState)
+}
+
+// CircuitBreakerOption represents the optional function of CircuitBreakerStore.
+type CircuitBreakerOption struct {
+	F func(o *CircuitBreakerOptions)
+}
+
+// WithBreakerErrorRate opens the circuit when the rate of failed calls reaches rate, default is 0.5
+func WithBreakerErrorRate(rate float64) CircuitBreakerOption {
+	return CircuitBreakerOption{F: func(o *CircuitBreakerOptions) {
+		o.ErrorRateThreshold = rate
+	}}
+}
+
+// WithBreakerSlowCall opens the circuit when the rate of calls taking longer than d reaches rate
+func WithBreakerSlowCall(d time.Duration, rate float64) CircuitBreakerOption {
+	return CircuitBreakerOption{F: func(o *CircuitBreakerOptions) {
+		o.SlowCallDuration = d
+		o.SlowCallRateThreshold = rate
+	}}
+}
+
+// WithBreakerMinRequests set up the minimum number of calls in a window to evaluate, default is 20
+func WithBreakerMinRequests(n int) CircuitBreakerOption {
+	return CircuitBreakerOption{F: func(o *CircuitBreakerOptions) {
+		o.MinRequests = n
+	}}
+}
+
+// WithBreakerWindow set up the length of the counting window, default is 10s
+func WithBreakerWindow(d time.Duration) CircuitBreakerOption {
+	return CircuitBreakerOption{F: func(o *CircuitBreakerOptions) {
+		o.Window = d
+	}}
+}
+
+// WithBreakerOpenTimeout set up the time to stay open before probing, default is 5s
+func WithBreakerOpenTimeout(d time.Duration) CircuitBreakerOption {
+	return CircuitBreakerOption{F: func(o *CircuitBreakerOptions) {
+		o.OpenTimeout = d
+	}}
+}
+
+// WithBreakerHalfOpenProbes set up the number of successful probes to close the circuit, default is 1,
+// which is also used for a non-positive n
+func WithBreakerHalfOpenProbes(n int) CircuitBreakerOption {
+	return CircuitBreakerOption{F: func(o *CircuitBreakerOptions) {
+		o.HalfOpenProbes = n
+	}}
+}
+
+// WithBreakerStateChange will be called when the state of the circuit changes
+func WithBreakerStateChange(cb func(from, to CircuitState)) CircuitBreakerOption {
+	return CircuitBreakerOption{F: func(o *CircuitBreakerOptions) {
+		o.OnStateChange = cb
+	}}
+}
+
+// CircuitBreakerStore decorates a CacheStore with a circuit breaker, so that a slow or unavailable
+// store is short-circuited instead of adding its latency to every request
+type CircuitBreakerStore struct {
+	store   CacheStore
+	options CircuitBreakerOptions
+
+	mu          sync.Mutex
+	state       CircuitState
+	windowStart time.Time
+	requests    int
+	failures    int
+	slowCalls   int
+	openedAt    time.Time
+	probes      int
+	successes   int
+	changes     []stateChange
+	// generation increases on every state change, the calls admitted in a previous state are not counted
+	generation uint64
+}
+
+type stateChange struct {
+	from, to CircuitState
+}
+
+// NewCircuitBreakerStore wraps the store with a circuit breaker
+func NewCircuitBreakerStore(store CacheStore, opts ...CircuitBreakerOption) *CircuitBreakerStore {
+	options := CircuitBreakerOptions{
+		ErrorRateThreshold: 0.5,
+		MinRequests:        20,
+		Window:             10 * time.Second,
+		OpenTimeout:        5 * time.Second,
+		HalfOpenProbes:     1,
+		OnStateChange:      func(from, to CircuitState) {},
+	}
+	for _, opt := range opts {
+		opt.F(&options)
+	}
+	if options.HalfOpenProbes < 1 {
+		options.HalfOpenProbes = 1
+	}
+
+	return &CircuitBreakerStore{
+		store:       store,
+		options:     options,
+		windowStart: time.Now(),
+	}
+}
+
+// State returns the current state of the circuit
+func (s *CircuitBreakerStore) State() CircuitState {
+	defer s.notify()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.refreshLocked(time.Now())
+	return s.state
+}
+
+// Get retrieves an item from the store, returns ErrCacheMiss while the circuit is open
+func (s *CircuitBreakerStore) Get(ctx context.Context, key string, value interface{}) error {
+	generation, ok := s.allow()
+	if !ok {
+		return ErrCacheMiss
+	}
+
+	start := time.Now()
+	err := s.store.Get(ctx, key, value)
+	s.record(generation, time.Since(start), err)
+	return err
+}
+
+// Set sets an item to the store, does nothing while the circuit is open
+func (s *CircuitBreakerStore) Set(ctx context.Context, key string, value interface{}, expire time.Duration) error {
+	generation, ok := s.allow()
+	if !ok {
+		return nil
+	}
+
+	start := time.Now()
+	err := s.store.Set(ctx, key, value, expire)
+	s.record(generation, time.Since(start), err)
+	return err
+}
+
+// Delete removes an item from the store, does nothing while the circuit is open
+func (s *CircuitBreakerStore) Delete(ctx context.Context, key string) error {
+	generation, ok := s.allow()
+	if !ok {
+		return nil
+	}
+
+	start := time.Now()
+	err := s.store.Delete(ctx, key)
+	s.record(generation, time.Since(start), err)
+	return err
+}
+
+// DeletePrefix removes the items whose keys start with prefix from the store, does nothing while the circuit is open.
+// Return ErrPrefixDeleteUnsupported if the store does not implement PrefixDeleter.
+func (s *CircuitBreakerStore) DeletePrefix(ctx context.Context, prefix string) error {
+	deleter, ok := s.store.(PrefixDeleter)
+	if !ok {
+		return ErrPrefixDeleteUnsupported
+	}
+	generation, ok := s.allow()
+	if !ok {
+		return nil
+	}
+
+	start := time.Now()
+	err := deleter.DeletePrefix(ctx, prefix)
+	s.record(generation, time.Since(start), err)
+	return err
+}
+
+// allow reports whether the call should be passed to the store, and the generation of the state it is admitted in
+func (s *CircuitBreakerStore) allow() (uint64, bool) {
+	defer s.notify()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.refreshLocked(time.Now())
+	switch s.state {
+	case CircuitOpen:
+		return 0, false
+	case CircuitHalfOpen:
+		if s.probes >= s.options.HalfOpenProbes {
+			return 0, false
+		}
+		s.probes++
+	}
+	return s.generation, true
+}
+
+// record counts the result of a call passed to the store in the state of generation.
+// The calls finishing after the state changed are ignored, e.g. a call admitted closed is not a probe.
+func (s *CircuitBreakerStore) record(generation uint64, latency time.Duration, err error) {
+	failed := err != nil && !errors.Is(err, ErrCacheMiss)
+	slow := s.options.SlowCallDuration > 0 && latency >= s.options.SlowCallDuration
+
+	defer s.notify()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.refreshLocked(now)
+	if s.generation != generation {
+		return
+	}
+	switch s.state {
+	case CircuitHalfOpen:
+		if failed || slow {
+			s.transitLocked(CircuitOpen, now)
+			return
+		}
+		s.successes++
+		if s.successes >= s.options.HalfOpenProbes {
+			s.transitLocked(CircuitClosed, now)
+		}
+	case CircuitClosed:
+		s.requests++
+		if failed {
+			s.failures++
+		}
+		if slow {
+			s.slowCalls++
+		}
+		if s.shouldTripLocked() {
+			s.transitLocked(CircuitOpen, now)
+		}
+	}
+}
+
+func (s *CircuitBreakerStore) shouldTripLocked() bool {
+	if s.requests < s.options.MinRequests || s.requests == 0 {
+		return false
+	}
+
+	requests := float64(s.requests)
+	if s.options.ErrorRateThreshold > 0 && float64(s.failures)/requests >= s.options.ErrorRateThreshold {
+		return true
+	}
+	return s.options.SlowCallDuration > 0 && s.options.SlowCallRateThreshold > 0 &&
+		float64(s.slowCalls)/requests >= s.options.SlowCallRateThreshold
+}
+
+// refreshLocked moves to half-open after the open timeout and resets the expired counting window
+func (s *CircuitBreakerStore) refreshLocked(now time.Time) {
+	switch s.state {
+	case CircuitOpen:
+		if now.Sub(s.openedAt) >= s.options.OpenTimeout {
+			s.transitLocked(CircuitHalfOpen, now)
+		}
+	case CircuitClosed:
+		if now.Sub(s.windowStart) >= s.options.Window {
+			s.resetWindowLocked(now)
+		}
+	}
+}
+
+func (s *CircuitBreakerStore) resetWindowLocked(now time.Time) {
+	s.windowStart = now
+	s.requests = 0
+	s.failures = 0
+	s.slowCalls = 0
+}
+
+func (s *CircuitBreakerStore) transitLocked(to CircuitState, now time.Time) {
+	from := s.state
+	s.state = to
+	s.generation++
+	s.probes = 0
+	s.successes = 0
+	switch to {
+	case CircuitOpen:
+		s.openedAt = now
+	case CircuitClosed:
+		s.resetWindowLocked(now)
+	}
+	s.changes = append(s.changes, stateChange{from: from, to: to})
+}
+
+// notify calls OnStateChange for the pending state changes outside the lock
+func (s *CircuitBreakerStore) notify() {
+	s.mu.Lock()
+	changes := s.changes
+	s.changes = nil
+	s.mu.Unlock()
+
+	for _, change := range changes {
+		s.options.OnStateChange(change.from, change.to)
+	}
+}
+
+// Close closes the underlying store if it implements Closer
+func (s *CircuitBreakerStore) Close() error {
+	return CloseStore(s.store)
+}
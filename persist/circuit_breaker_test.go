@@ -0,0 +1,227 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package persist
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+)
+
+var errUnavailable = errors.New("unavailable")
+
+// flakyStore wraps a MemoryStore and fails or delays every call when configured
+type flakyStore struct {
+	*MemoryStore
+	failing int32
+	delay   time.Duration
+	calls   int32
+}
+
+func (s *flakyStore) call() error {
+	atomic.AddInt32(&s.calls, 1)
+	time.Sleep(s.delay)
+	if atomic.LoadInt32(&s.failing) == 1 {
+		return errUnavailable
+	}
+	return nil
+}
+
+func (s *flakyStore) Get(ctx context.Context, key string, value interface{}) error {
+	if err := s.call(); err != nil {
+		return err
+	}
+	return s.MemoryStore.Get(ctx, key, value)
+}
+
+func (s *flakyStore) Set(ctx context.Context, key string, value interface{}, expire time.Duration) error {
+	if err := s.call(); err != nil {
+		return err
+	}
+	return s.MemoryStore.Set(ctx, key, value, expire)
+}
+
+func TestCircuitBreakerStore(t *testing.T) {
+	ctx := context.Background()
+	inner := &flakyStore{MemoryStore: NewMemoryStore(time.Minute), failing: 1}
+
+	var mu sync.Mutex
+	var changes []CircuitState
+	store := NewCircuitBreakerStore(inner,
+		WithBreakerMinRequests(4),
+		WithBreakerErrorRate(0.5),
+		WithBreakerOpenTimeout(50*time.Millisecond),
+		WithBreakerHalfOpenProbes(2),
+		WithBreakerStateChange(func(from, to CircuitState) {
+			mu.Lock()
+			defer mu.Unlock()
+			changes = append(changes, to)
+		}),
+	)
+
+	value := ""
+	for i := 0; i < 4; i++ {
+		assert.DeepEqual(t, errUnavailable, store.Get(ctx, "test", &value))
+	}
+	assert.DeepEqual(t, CircuitOpen, store.State())
+
+	// short-circuited while open
+	assert.DeepEqual(t, ErrCacheMiss, store.Get(ctx, "test", &value))
+	assert.Nil(t, store.Set(ctx, "test", "value", time.Minute))
+	assert.Nil(t, store.Delete(ctx, "test"))
+	assert.DeepEqual(t, int32(4), atomic.LoadInt32(&inner.calls))
+
+	// a failed probe opens the circuit again
+	time.Sleep(50 * time.Millisecond)
+	assert.DeepEqual(t, CircuitHalfOpen, store.State())
+	assert.DeepEqual(t, errUnavailable, store.Get(ctx, "test", &value))
+	assert.DeepEqual(t, CircuitOpen, store.State())
+
+	// successful probes close the circuit
+	atomic.StoreInt32(&inner.failing, 0)
+	time.Sleep(50 * time.Millisecond)
+	assert.Nil(t, store.Set(ctx, "test", "value", time.Minute))
+	assert.DeepEqual(t, CircuitHalfOpen, store.State())
+	assert.Nil(t, store.Get(ctx, "test", &value))
+	assert.DeepEqual(t, "value", value)
+	assert.DeepEqual(t, CircuitClosed, store.State())
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.DeepEqual(t, []CircuitState{CircuitOpen, CircuitHalfOpen, CircuitOpen, CircuitHalfOpen, CircuitClosed}, changes)
+}
+
+func TestCircuitBreakerStoreSlowCall(t *testing.T) {
+	ctx := context.Background()
+	inner := &flakyStore{MemoryStore: NewMemoryStore(time.Minute), delay: 5 * time.Millisecond}
+	store := NewCircuitBreakerStore(inner,
+		WithBreakerMinRequests(2),
+		WithBreakerSlowCall(time.Millisecond, 1),
+		WithBreakerWindow(time.Minute),
+	)
+
+	value := ""
+	assert.DeepEqual(t, ErrCacheMiss, store.Get(ctx, "test", &value))
+	assert.DeepEqual(t, CircuitClosed, store.State())
+	assert.DeepEqual(t, ErrCacheMiss, store.Get(ctx, "test", &value))
+	assert.DeepEqual(t, CircuitOpen, store.State())
+	assert.DeepEqual(t, "open", store.State().String())
+}
+
+// gatedStore blocks the calls of the keys in gates until their channel is closed
+type gatedStore struct {
+	*flakyStore
+	gates   map[string]chan struct{}
+	blocked int32
+}
+
+func (s *gatedStore) Get(ctx context.Context, key string, value interface{}) error {
+	if gate, ok := s.gates[key]; ok {
+		atomic.AddInt32(&s.blocked, 1)
+		<-gate
+		return s.MemoryStore.Get(ctx, key, value)
+	}
+	return s.flakyStore.Get(ctx, key, value)
+}
+
+func TestCircuitBreakerStoreNonPositiveProbes(t *testing.T) {
+	ctx := context.Background()
+	inner := &flakyStore{MemoryStore: NewMemoryStore(time.Minute), failing: 1}
+	store := NewCircuitBreakerStore(inner,
+		WithBreakerMinRequests(1),
+		WithBreakerOpenTimeout(10*time.Millisecond),
+		WithBreakerHalfOpenProbes(0),
+	)
+	assert.DeepEqual(t, 1, store.options.HalfOpenProbes)
+
+	value := ""
+	assert.DeepEqual(t, errUnavailable, store.Get(ctx, "test", &value))
+	assert.DeepEqual(t, CircuitOpen, store.State())
+
+	// a successful probe closes the circuit
+	atomic.StoreInt32(&inner.failing, 0)
+	time.Sleep(10 * time.Millisecond)
+	assert.DeepEqual(t, ErrCacheMiss, store.Get(ctx, "test", &value))
+	assert.DeepEqual(t, CircuitClosed, store.State())
+}
+
+func TestCircuitBreakerStoreStaleCall(t *testing.T) {
+	ctx := context.Background()
+	gate := make(chan struct{})
+	inner := &gatedStore{
+		flakyStore: &flakyStore{MemoryStore: NewMemoryStore(time.Minute), failing: 1},
+		gates:      map[string]chan struct{}{"slow": gate},
+	}
+	store := NewCircuitBreakerStore(inner,
+		WithBreakerMinRequests(2),
+		WithBreakerOpenTimeout(10*time.Millisecond),
+	)
+
+	// a call admitted while closed finishes after the circuit moved to half-open
+	done := make(chan error)
+	go func() {
+		value := ""
+		done <- store.Get(ctx, "slow", &value)
+	}()
+	for atomic.LoadInt32(&inner.blocked) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	value := ""
+	assert.DeepEqual(t, errUnavailable, store.Get(ctx, "test", &value))
+	assert.DeepEqual(t, errUnavailable, store.Get(ctx, "test", &value))
+	assert.DeepEqual(t, CircuitOpen, store.State())
+	time.Sleep(10 * time.Millisecond)
+	assert.DeepEqual(t, CircuitHalfOpen, store.State())
+
+	close(gate)
+	assert.DeepEqual(t, ErrCacheMiss, <-done)
+
+	// it is not counted as a probe, the circuit waits for one
+	assert.DeepEqual(t, CircuitHalfOpen, store.State())
+	atomic.StoreInt32(&inner.failing, 0)
+	assert.DeepEqual(t, ErrCacheMiss, store.Get(ctx, "test", &value))
+	assert.DeepEqual(t, CircuitClosed, store.State())
+}
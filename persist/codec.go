@@ -42,9 +42,180 @@ package persist
 
 import (
 	"bytes"
+	"encoding"
 	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
 )
 
+const (
+	// payloadMagic marks the payloads carrying a codec identifier, which never starts a gob stream
+	payloadMagic byte = 0xCA
+
+	// CodecIDGob the identifier of GobCodec
+	CodecIDGob byte = 1
+	// CodecIDJSON the identifier of JSONCodec
+	CodecIDJSON byte = 2
+	// CodecIDBinary the identifier of BinaryCodec
+	CodecIDBinary byte = 3
+)
+
+var (
+	// ErrUnknownCodec represent the payload is written with a codec not registered
+	ErrUnknownCodec = errors.New("persist unknown codec")
+	// ErrUnsupportedValue represent the value can not be handled by the codec
+	ErrUnsupportedValue = errors.New("persist unsupported value")
+)
+
+// Codec marshals the values into the payloads of a store
+type Codec interface {
+	// ID identifies the codec in the payloads, so that a store reads the entries written with any registered codec
+	ID() byte
+	Marshal(value interface{}) ([]byte, error)
+	Unmarshal(payload []byte, ptr interface{}) error
+}
+
+// GobCodec marshals the values with encoding/gob
+type GobCodec struct{}
+
+func (GobCodec) ID() byte {
+	return CodecIDGob
+}
+
+func (GobCodec) Marshal(value interface{}) ([]byte, error) {
+	return Serialize(value)
+}
+
+func (GobCodec) Unmarshal(payload []byte, ptr interface{}) error {
+	return Deserialize(payload, ptr)
+}
+
+// JSONCodec marshals the values with encoding/json, readable from other languages
+type JSONCodec struct{}
+
+func (JSONCodec) ID() byte {
+	return CodecIDJSON
+}
+
+func (JSONCodec) Marshal(value interface{}) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (JSONCodec) Unmarshal(payload []byte, ptr interface{}) error {
+	return json.Unmarshal(payload, ptr)
+}
+
+// BinaryCodec marshals the values implementing encoding.BinaryMarshaler, as well as []byte and string, as is.
+// It is the most compact and fastest codec for the types providing their own binary format.
+// Unmarshal also accepts a **T, allocating the *T implementing encoding.BinaryUnmarshaler.
+type BinaryCodec struct{}
+
+func (BinaryCodec) ID() byte {
+	return CodecIDBinary
+}
+
+func (BinaryCodec) Marshal(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case encoding.BinaryMarshaler:
+		return v.MarshalBinary()
+	case []byte:
+		return v, nil
+	case string:
+		return []byte(v), nil
+	}
+	return nil, fmt.Errorf("%w: %T", ErrUnsupportedValue, value)
+}
+
+func (BinaryCodec) Unmarshal(payload []byte, ptr interface{}) error {
+	switch v := ptr.(type) {
+	case encoding.BinaryUnmarshaler:
+		return v.UnmarshalBinary(payload)
+	case *[]byte:
+		*v = append([]byte(nil), payload...)
+		return nil
+	case *string:
+		*v = string(payload)
+		return nil
+	}
+
+	// **T, e.g. the middleware reads the cached response into a **ResponseCache
+	rv := reflect.ValueOf(ptr)
+	if rv.Kind() == reflect.Ptr && !rv.IsNil() && rv.Elem().Kind() == reflect.Ptr {
+		elem := reflect.New(rv.Elem().Type().Elem())
+		if u, ok := elem.Interface().(encoding.BinaryUnmarshaler); ok {
+			if err := u.UnmarshalBinary(payload); err != nil {
+				return err
+			}
+			rv.Elem().Set(elem)
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %T", ErrUnsupportedValue, ptr)
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[byte]Codec{
+		CodecIDGob:    GobCodec{},
+		CodecIDJSON:   JSONCodec{},
+		CodecIDBinary: BinaryCodec{},
+	}
+)
+
+// RegisterCodec registers a custom codec, so that the stores can read the payloads written with it.
+// The gob, JSON and binary codecs are registered by default.
+func RegisterCodec(codec Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[codec.ID()] = codec
+}
+
+func lookupCodec(id byte) (Codec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	codec, ok := codecs[id]
+	return codec, ok
+}
+
+// codecFor returns codec if set, otherwise BinaryCodec for []byte and the values implementing encoding.BinaryMarshaler, and GobCodec for the others
+func codecFor(codec Codec, value interface{}) Codec {
+	if codec != nil {
+		return codec
+	}
+	switch value.(type) {
+	case encoding.BinaryMarshaler, []byte:
+		return BinaryCodec{}
+	}
+	return GobCodec{}
+}
+
+// encodePayload marshals value with codec, prefixed by the magic byte and the codec identifier
+func encodePayload(codec Codec, value interface{}) ([]byte, error) {
+	data, err := codec.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	payload := make([]byte, 0, len(data)+2)
+	payload = append(payload, payloadMagic, codec.ID())
+	return append(payload, data...), nil
+}
+
+// decodePayload unmarshals the payload with the codec it is written with,
+// the payloads without the codec identifier are written by Serialize
+func decodePayload(payload []byte, ptr interface{}) error {
+	if len(payload) < 2 || payload[0] != payloadMagic {
+		return Deserialize(payload, ptr)
+	}
+	codec, ok := lookupCodec(payload[1])
+	if !ok {
+		return fmt.Errorf("%w: %d", ErrUnknownCodec, payload[1])
+	}
+	return codec.Unmarshal(payload[2:], ptr)
+}
+
 // Serialize returns a []byte representing the passed value
 func Serialize(value interface{}) ([]byte, error) {
 	var b bytes.Buffer
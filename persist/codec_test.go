@@ -41,6 +41,8 @@
 package persist
 
 import (
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/cloudwego/hertz/pkg/common/test/assert"
@@ -70,3 +72,93 @@ func TestCodec(t *testing.T) {
 	assert.DeepEqual(t, src.B, dest.B)
 	assert.DeepEqual(t, src.C, dest.C)
 }
+
+func TestCodecs(t *testing.T) {
+	src := &testStruct{A: 1, B: "2"}
+	for _, codec := range []Codec{GobCodec{}, JSONCodec{}} {
+		payload, err := encodePayload(codec, src)
+		assert.Nil(t, err)
+		assert.DeepEqual(t, []byte{payloadMagic, codec.ID()}, payload[:2])
+
+		var dest *testStruct
+		assert.Nil(t, decodePayload(payload, &dest))
+		assert.DeepEqual(t, src, dest)
+	}
+
+	payload, err := encodePayload(BinaryCodec{}, "binary")
+	assert.Nil(t, err)
+	assert.DeepEqual(t, append([]byte{payloadMagic, CodecIDBinary}, "binary"...), payload)
+	var dest string
+	assert.Nil(t, decodePayload(payload, &dest))
+	assert.DeepEqual(t, "binary", dest)
+
+	_, err = BinaryCodec{}.Marshal(src)
+	assert.True(t, errors.Is(err, ErrUnsupportedValue))
+	assert.True(t, errors.Is(BinaryCodec{}.Unmarshal(payload, &testStruct{}), ErrUnsupportedValue))
+}
+
+func TestDecodeLegacyPayload(t *testing.T) {
+	payload, err := Serialize("legacy")
+	assert.Nil(t, err)
+	var dest string
+	assert.Nil(t, decodePayload(payload, &dest))
+	assert.DeepEqual(t, "legacy", dest)
+}
+
+type upperCodec struct{}
+
+func (upperCodec) ID() byte {
+	return 100
+}
+
+func (upperCodec) Marshal(value interface{}) ([]byte, error) {
+	return []byte(strings.ToUpper(value.(string))), nil
+}
+
+func (upperCodec) Unmarshal(payload []byte, ptr interface{}) error {
+	*ptr.(*string) = string(payload)
+	return nil
+}
+
+func TestRegisterCodec(t *testing.T) {
+	payload, err := encodePayload(upperCodec{}, "custom")
+	assert.Nil(t, err)
+
+	var dest string
+	assert.True(t, errors.Is(decodePayload(payload, &dest), ErrUnknownCodec))
+
+	RegisterCodec(upperCodec{})
+	assert.Nil(t, decodePayload(payload, &dest))
+	assert.DeepEqual(t, "CUSTOM", dest)
+}
+
+type binaryValue struct {
+	V string
+}
+
+func (v *binaryValue) MarshalBinary() ([]byte, error) {
+	return []byte(v.V), nil
+}
+
+func (v *binaryValue) UnmarshalBinary(data []byte) error {
+	v.V = string(data)
+	return nil
+}
+
+func TestBinaryCodecPointer(t *testing.T) {
+	assert.DeepEqual(t, BinaryCodec{}, codecFor(nil, &binaryValue{}))
+	assert.DeepEqual(t, GobCodec{}, codecFor(nil, "gob"))
+	assert.DeepEqual(t, JSONCodec{}, codecFor(JSONCodec{}, &binaryValue{}))
+
+	payload, err := encodePayload(codecFor(nil, &binaryValue{V: "binary"}), &binaryValue{V: "binary"})
+	assert.Nil(t, err)
+	assert.DeepEqual(t, append([]byte{payloadMagic, CodecIDBinary}, "binary"...), payload)
+
+	var dest *binaryValue
+	assert.Nil(t, decodePayload(payload, &dest))
+	assert.DeepEqual(t, &binaryValue{V: "binary"}, dest)
+
+	var value binaryValue
+	assert.Nil(t, decodePayload(payload, &value))
+	assert.DeepEqual(t, "binary", value.V)
+}
@@ -0,0 +1,234 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package persist
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+const (
+	// compressedMagic marks the compressed payloads, followed by the compressor identifier
+	compressedMagic byte = 0xCB
+
+	// CompressorIDGzip the identifier of GzipCompressor
+	CompressorIDGzip byte = 1
+	// CompressorIDFlate the identifier of FlateCompressor
+	CompressorIDFlate byte = 2
+
+	// DefaultMaxDecompressedSize the default maximum size in bytes of a decompressed payload
+	DefaultMaxDecompressedSize int64 = 64 << 20
+)
+
+var (
+	// ErrUnknownCompressor represent the payload is compressed with a compressor not registered
+	ErrUnknownCompressor = errors.New("persist unknown compressor")
+	// ErrDecompressedTooLarge represent the payload decompresses to more than the maximum size of the compressor
+	ErrDecompressedTooLarge = errors.New("persist decompressed payload too large")
+)
+
+// Compressor compresses the payloads of a store
+type Compressor interface {
+	// ID identifies the compressor in the payloads, so that a store reads the entries compressed with any registered compressor
+	ID() byte
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+// GzipCompressor compresses the payloads with compress/gzip
+type GzipCompressor struct {
+	// Level the compression level, zero means gzip.DefaultCompression
+	Level int
+	// MaxSize the maximum size in bytes of a decompressed payload, non-positive means DefaultMaxDecompressedSize
+	MaxSize int64
+}
+
+func (GzipCompressor) ID() byte {
+	return CompressorIDGzip
+}
+
+func (c GzipCompressor) Compress(data []byte) ([]byte, error) {
+	level := c.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+
+	var b bytes.Buffer
+	w, err := gzip.NewWriterLevel(&b, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (c GzipCompressor) Decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return readAllLimited(r, c.MaxSize)
+}
+
+// FlateCompressor compresses the payloads with compress/flate, without the header and checksum of gzip
+type FlateCompressor struct {
+	// Level the compression level, zero means flate.DefaultCompression
+	Level int
+	// MaxSize the maximum size in bytes of a decompressed payload, non-positive means DefaultMaxDecompressedSize
+	MaxSize int64
+}
+
+func (FlateCompressor) ID() byte {
+	return CompressorIDFlate
+}
+
+func (c FlateCompressor) Compress(data []byte) ([]byte, error) {
+	level := c.Level
+	if level == 0 {
+		level = flate.DefaultCompression
+	}
+
+	var b bytes.Buffer
+	w, err := flate.NewWriter(&b, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (c FlateCompressor) Decompress(data []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(data))
+	defer r.Close()
+	return readAllLimited(r, c.MaxSize)
+}
+
+// readAllLimited reads r until EOF, and returns ErrDecompressedTooLarge once more than maxSize bytes are read,
+// so that a small payload can not expand into an unbounded allocation
+func readAllLimited(r io.Reader, maxSize int64) ([]byte, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxDecompressedSize
+	}
+	data, err := io.ReadAll(io.LimitReader(r, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrDecompressedTooLarge, maxSize)
+	}
+	return data, nil
+}
+
+var (
+	compressorsMu sync.RWMutex
+	compressors   = map[byte]Compressor{
+		CompressorIDGzip:  GzipCompressor{},
+		CompressorIDFlate: FlateCompressor{},
+	}
+)
+
+// RegisterCompressor registers a custom compressor, so that the stores can read the payloads compressed with it.
+// The gzip and flate compressors are registered by default, registering e.g. GzipCompressor{MaxSize: n}
+// changes the maximum size of the gzip payloads read by the stores not compressing with gzip.
+func RegisterCompressor(compressor Compressor) {
+	compressorsMu.Lock()
+	defer compressorsMu.Unlock()
+	compressors[compressor.ID()] = compressor
+}
+
+func lookupCompressor(id byte) (Compressor, bool) {
+	compressorsMu.RLock()
+	defer compressorsMu.RUnlock()
+	compressor, ok := compressors[id]
+	return compressor, ok
+}
+
+// compressPayload compresses the payload reaching threshold, prefixed by the magic byte and the compressor identifier.
+// The payload is kept as is if compressor is nil, or if compressing does not make it smaller.
+func compressPayload(compressor Compressor, threshold int, payload []byte) ([]byte, error) {
+	if compressor == nil || len(payload) < threshold {
+		return payload, nil
+	}
+
+	data, err := compressor.Compress(payload)
+	if err != nil {
+		return nil, err
+	}
+	if len(data)+2 >= len(payload) {
+		return payload, nil
+	}
+	compressed := make([]byte, 0, len(data)+2)
+	compressed = append(compressed, compressedMagic, compressor.ID())
+	return append(compressed, data...), nil
+}
+
+// decompressPayload decompresses the payload compressed by compressPayload, the other payloads are returned as is.
+// The payload is decompressed with preferred if it has the same identifier, e.g. to apply its maximum size,
+// or with the registered compressor of the identifier.
+func decompressPayload(preferred Compressor, payload []byte) ([]byte, error) {
+	if len(payload) < 2 || payload[0] != compressedMagic {
+		return payload, nil
+	}
+	compressor := preferred
+	if compressor == nil || compressor.ID() != payload[1] {
+		var ok bool
+		if compressor, ok = lookupCompressor(payload[1]); !ok {
+			return nil, fmt.Errorf("%w: %d", ErrUnknownCompressor, payload[1])
+		}
+	}
+	return compressor.Decompress(payload[2:])
+}
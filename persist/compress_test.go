@@ -0,0 +1,138 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package persist
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestCompressPayload(t *testing.T) {
+	payload := bytes.Repeat([]byte("<html></html>"), 100)
+	for _, compressor := range []Compressor{GzipCompressor{}, FlateCompressor{Level: 9}} {
+		compressed, err := compressPayload(compressor, 1024, payload)
+		assert.Nil(t, err)
+		assert.DeepEqual(t, []byte{compressedMagic, compressor.ID()}, compressed[:2])
+		assert.True(t, len(compressed) < len(payload))
+
+		decompressed, err := decompressPayload(nil, compressed)
+		assert.Nil(t, err)
+		assert.DeepEqual(t, payload, decompressed)
+	}
+
+	// below the threshold, or not shrinking
+	small, err := compressPayload(GzipCompressor{}, 1024, payload[:100])
+	assert.Nil(t, err)
+	assert.DeepEqual(t, payload[:100], small)
+	incompressible, err := compressPayload(GzipCompressor{}, 0, []byte{1, 2, 3})
+	assert.Nil(t, err)
+	assert.DeepEqual(t, []byte{1, 2, 3}, incompressible)
+
+	_, err = decompressPayload(nil, []byte{compressedMagic, 100, 1})
+	assert.True(t, errors.Is(err, ErrUnknownCompressor))
+	_, err = decompressPayload(nil, []byte{compressedMagic, CompressorIDGzip, 1})
+	assert.NotNil(t, err)
+}
+
+func TestDecompressMaxSize(t *testing.T) {
+	payload := bytes.Repeat([]byte{0}, 1024)
+	for _, compressor := range []Compressor{GzipCompressor{MaxSize: 1024}, FlateCompressor{MaxSize: 1024}} {
+		compressed, err := compressPayload(compressor, 0, payload)
+		assert.Nil(t, err)
+		decompressed, err := decompressPayload(compressor, compressed)
+		assert.Nil(t, err)
+		assert.DeepEqual(t, payload, decompressed)
+
+		// a payload expanding beyond the maximum size is rejected
+		compressed, err = compressPayload(compressor, 0, append(payload, 0))
+		assert.Nil(t, err)
+		_, err = decompressPayload(compressor, compressed)
+		assert.True(t, errors.Is(err, ErrDecompressedTooLarge))
+		// the registered compressors are bounded by DefaultMaxDecompressedSize
+		_, err = decompressPayload(nil, compressed)
+		assert.Nil(t, err)
+	}
+
+	bomb, err := GzipCompressor{}.Compress(make([]byte, DefaultMaxDecompressedSize+1))
+	assert.Nil(t, err)
+	_, err = decompressPayload(nil, append([]byte{compressedMagic, CompressorIDGzip}, bomb...))
+	assert.True(t, errors.Is(err, ErrDecompressedTooLarge))
+}
+
+func TestRedisStoreCompression(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "127.0.0.1:6379",
+	})
+	ctx := context.Background()
+	plainStore := NewRedisStore(client)
+	store := NewRedisStore(client, WithCompression(GzipCompressor{}, 256))
+	defer client.Del(ctx, "test-compress", "test-legacy-compress")
+
+	body := string(bytes.Repeat([]byte(`{"uid":1}`), 100))
+	assert.Nil(t, store.Set(ctx, "test-compress", body, time.Minute))
+	payload, err := client.Get(ctx, "test-compress").Bytes()
+	assert.Nil(t, err)
+	assert.DeepEqual(t, []byte{compressedMagic, CompressorIDGzip}, payload[:2])
+	assert.True(t, len(payload) < len(body))
+
+	value := ""
+	assert.Nil(t, store.Get(ctx, "test-compress", &value))
+	assert.DeepEqual(t, body, value)
+	// the stores without compression read the compressed entries as well
+	assert.Nil(t, plainStore.Get(ctx, "test-compress", &value))
+	assert.DeepEqual(t, body, value)
+
+	assert.Nil(t, plainStore.Set(ctx, "test-legacy-compress", body, time.Minute))
+	assert.Nil(t, store.Get(ctx, "test-legacy-compress", &value))
+	assert.DeepEqual(t, body, value)
+
+	// the reads are bounded by the maximum size of the compressor of the store
+	boundedStore := NewRedisStore(client, WithCompression(GzipCompressor{MaxSize: 256}, 256))
+	err = boundedStore.Get(ctx, "test-compress", &value)
+	assert.True(t, errors.Is(err, ErrSerialization))
+	assert.True(t, errors.Is(err, ErrDecompressedTooLarge))
+}
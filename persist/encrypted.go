@@ -0,0 +1,252 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package persist
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// encryptedMagic marks the encrypted payloads, followed by the key id, the nonce and the sealed payload
+const encryptedMagic byte = 0xCC
+
+var (
+	// ErrDecryption represent the payload can not be decrypted, e.g. it is tampered or its key is removed from the keyring.
+	// The store returns it as a miss carrying the cause, errors.Is(err, ErrCacheMiss) is true.
+	ErrDecryption = errors.New("persist decryption error")
+	// ErrInvalidKeyring represent the keyring is misconfigured
+	ErrInvalidKeyring = errors.New("persist invalid keyring")
+)
+
+const (
+	errMissingKeyring          = "[CACHE] keyring of the encrypted store is nil"
+	errMissingPrimaryKeyFormat = "[CACHE] primary key %d not found in the keyring of the encrypted store"
+)
+
+// Keyring holds the AES keys by id, the values are encrypted with the primary key and
+// decrypted with the key whose id is embedded in the payload, so that the keys can be rotated.
+type Keyring struct {
+	primary byte
+	aeads   map[byte]cipher.AEAD
+}
+
+// NewKeyring create a keyring from AES-128, AES-192 or AES-256 keys, primary is the id of the key to encrypt with
+func NewKeyring(primary byte, keys map[byte][]byte) (*Keyring, error) {
+	if _, ok := keys[primary]; !ok {
+		return nil, fmt.Errorf("%w: primary key %d not found", ErrInvalidKeyring, primary)
+	}
+
+	keyring := &Keyring{primary: primary, aeads: make(map[byte]cipher.AEAD, len(keys))}
+	for id, key := range keys {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %d: %s", ErrInvalidKeyring, id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %d: %s", ErrInvalidKeyring, id, err)
+		}
+		keyring.aeads[id] = aead
+	}
+	return keyring, nil
+}
+
+// seal encrypts plaintext with the primary key, the storage key is authenticated so that an entry can not be moved to another key
+func (k *Keyring) seal(key string, plaintext []byte) ([]byte, error) {
+	aead := k.aeads[k.primary]
+	nonceSize := aead.NonceSize()
+	payload := make([]byte, 2+nonceSize, 2+nonceSize+len(plaintext)+aead.Overhead())
+	payload[0], payload[1] = encryptedMagic, k.primary
+	if _, err := rand.Read(payload[2:]); err != nil {
+		return nil, err
+	}
+	return aead.Seal(payload, payload[2:], plaintext, []byte(key)), nil
+}
+
+func (k *Keyring) open(key string, payload []byte) ([]byte, error) {
+	if len(payload) < 2 || payload[0] != encryptedMagic {
+		return nil, errors.New("payload is not encrypted")
+	}
+	aead, ok := k.aeads[payload[1]]
+	if !ok {
+		return nil, fmt.Errorf("key %d not found", payload[1])
+	}
+	nonceSize := aead.NonceSize()
+	if len(payload) < 2+nonceSize+aead.Overhead() {
+		return nil, errors.New("payload is truncated")
+	}
+	return aead.Open(nil, payload[2:2+nonceSize], payload[2+nonceSize:], []byte(key))
+}
+
+// EncryptedStoreOptions contains the options of EncryptedStore
+type EncryptedStoreOptions struct {
+	// Codec marshals the values before encrypting, nil picks the codec by the value
+	Codec Codec
+	// HMACKey if set, the keys are replaced with their HMAC-SHA256 in the underlying store
+	HMACKey []byte
+}
+
+// EncryptedStoreOption represents the optional function of EncryptedStore.
+type EncryptedStoreOption struct {
+	F func(o *EncryptedStoreOptions)
+}
+
+// WithEncryptedCodec set up the codec of the values before encrypting, default picks the codec by the value like RedisStore
+func WithEncryptedCodec(codec Codec) EncryptedStoreOption {
+	return EncryptedStoreOption{F: func(o *EncryptedStoreOptions) {
+		o.Codec = codec
+	}}
+}
+
+// WithKeyHMAC replaces the keys with their HMAC-SHA256 under secret, so that the raw urls are not visible in the underlying store
+func WithKeyHMAC(secret []byte) EncryptedStoreOption {
+	return EncryptedStoreOption{F: func(o *EncryptedStoreOptions) {
+		o.HMACKey = secret
+	}}
+}
+
+// EncryptedStore encrypts the values with AES-GCM before putting them to the underlying store.
+// The payloads failing to decrypt are returned as misses carrying ErrDecryption, so that they are regenerated.
+type EncryptedStore struct {
+	store   CacheStore
+	keyring *Keyring
+	options EncryptedStoreOptions
+}
+
+// NewEncryptedStore create an encrypted store in front of store, it panics if keyring is nil or has no primary key,
+// use NewKeyring to create it
+func NewEncryptedStore(store CacheStore, keyring *Keyring, opts ...EncryptedStoreOption) *EncryptedStore {
+	if keyring == nil {
+		panic(errMissingKeyring)
+	}
+	if _, ok := keyring.aeads[keyring.primary]; !ok {
+		panic(fmt.Sprintf(errMissingPrimaryKeyFormat, keyring.primary))
+	}
+
+	options := EncryptedStoreOptions{}
+	for _, opt := range opts {
+		opt.F(&options)
+	}
+
+	return &EncryptedStore{
+		store:   store,
+		keyring: keyring,
+		options: options,
+	}
+}
+
+// storageKey returns the key in the underlying store
+func (s *EncryptedStore) storageKey(key string) string {
+	if s.options.HMACKey == nil {
+		return key
+	}
+	mac := hmac.New(sha256.New, s.options.HMACKey)
+	mac.Write([]byte(key))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Set encrypts value and put it to the underlying store
+func (s *EncryptedStore) Set(ctx context.Context, key string, value interface{}, expire time.Duration) error {
+	plaintext, err := encodePayload(codecFor(s.options.Codec, value), value)
+	if err != nil {
+		return NewSerializationError(opSet, err)
+	}
+
+	storageKey := s.storageKey(key)
+	payload, err := s.keyring.seal(storageKey, sealEnvelope(value, plaintext))
+	if err != nil {
+		return WrapError(opSet, err)
+	}
+	if _, ok := LockToken(ctx); ok {
+		// the lock and its fencing token are on key, not on the storage key
+		ctx = withLockedKey(ctx, key)
+	}
+	return s.store.Set(ctx, storageKey, payload, expire)
+}
+
+// Delete remove key in the underlying store
+func (s *EncryptedStore) Delete(ctx context.Context, key string) error {
+	return s.store.Delete(ctx, s.storageKey(key))
+}
+
+// DeletePrefix removes the items whose keys start with prefix in the underlying store.
+// Return ErrPrefixDeleteUnsupported with WithKeyHMAC, the storage keys do not keep the prefixes then.
+func (s *EncryptedStore) DeletePrefix(ctx context.Context, prefix string) error {
+	if s.options.HMACKey != nil {
+		return ErrPrefixDeleteUnsupported
+	}
+	return DeletePrefix(ctx, s.store, prefix)
+}
+
+// Get retrieves and decrypts an item from the underlying store, if key doesn't exist, return ErrCacheMiss.
+// If the payload can not be decrypted, return a StoreError of ErrDecryption wrapping ErrCacheMiss.
+func (s *EncryptedStore) Get(ctx context.Context, key string, value interface{}) error {
+	storageKey := s.storageKey(key)
+	var payload []byte
+	if err := s.store.Get(ctx, storageKey, &payload); err != nil {
+		return err
+	}
+
+	plaintext, err := s.keyring.open(storageKey, payload)
+	if err != nil {
+		return &StoreError{Op: opGet, Kind: ErrDecryption, Err: fmt.Errorf("%w: %s", ErrCacheMiss, err)}
+	}
+	if plaintext, err = openEnvelope(plaintext, value); err != nil {
+		return err
+	}
+	if err := decodePayload(plaintext, value); err != nil {
+		return NewSerializationError(opGet, err)
+	}
+	return nil
+}
+
+// Close closes the underlying store if it implements Closer
+func (s *EncryptedStore) Close() error {
+	return CloseStore(s.store)
+}
@@ -0,0 +1,191 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package persist
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/go-redis/redis/v8"
+)
+
+func newTestKeyring(t *testing.T, primary byte) *Keyring {
+	keyring, err := NewKeyring(primary, map[byte][]byte{
+		1: bytes.Repeat([]byte{1}, 32),
+		2: bytes.Repeat([]byte{2}, 16),
+	})
+	assert.Nil(t, err)
+	return keyring
+}
+
+func TestNewKeyring(t *testing.T) {
+	_, err := NewKeyring(3, map[byte][]byte{1: bytes.Repeat([]byte{1}, 32)})
+	assert.True(t, errors.Is(err, ErrInvalidKeyring))
+	_, err = NewKeyring(1, map[byte][]byte{1: []byte("short")})
+	assert.True(t, errors.Is(err, ErrInvalidKeyring))
+}
+
+func TestEncryptedStore(t *testing.T) {
+	ctx := context.Background()
+	memoryStore := NewMemoryStore(time.Minute)
+	store := NewEncryptedStore(memoryStore, newTestKeyring(t, 1))
+
+	assert.Nil(t, store.Set(ctx, "/user?id=1", "pii", time.Minute))
+	var payload []byte
+	assert.Nil(t, memoryStore.Get(ctx, "/user?id=1", &payload))
+	assert.DeepEqual(t, []byte{encryptedMagic, 1}, payload[:2])
+	assert.False(t, bytes.Contains(payload, []byte("pii")))
+
+	value := ""
+	assert.Nil(t, store.Get(ctx, "/user?id=1", &value))
+	assert.DeepEqual(t, "pii", value)
+
+	assert.Nil(t, store.Delete(ctx, "/user?id=1"))
+	assert.DeepEqual(t, ErrCacheMiss, store.Get(ctx, "/user?id=1", &value))
+}
+
+func TestEncryptedStoreKeyHMAC(t *testing.T) {
+	ctx := context.Background()
+	memoryStore := NewMemoryStore(time.Minute)
+	store := NewEncryptedStore(memoryStore, newTestKeyring(t, 1), WithKeyHMAC([]byte("secret")))
+
+	assert.Nil(t, store.Set(ctx, "/user?id=1", "pii", time.Minute))
+	assert.DeepEqual(t, []string{store.storageKey("/user?id=1")}, memoryStore.Cache.GetKeys())
+	assert.DeepEqual(t, 64, len(store.storageKey("/user?id=1")))
+
+	value := ""
+	assert.Nil(t, store.Get(ctx, "/user?id=1", &value))
+	assert.DeepEqual(t, "pii", value)
+}
+
+func TestEncryptedStoreRotation(t *testing.T) {
+	ctx := context.Background()
+	memoryStore := NewMemoryStore(time.Minute)
+	assert.Nil(t, NewEncryptedStore(memoryStore, newTestKeyring(t, 1)).Set(ctx, "old", "v1", time.Minute))
+
+	// the entries encrypted with the previous primary key are still readable
+	rotated := NewEncryptedStore(memoryStore, newTestKeyring(t, 2))
+	value := ""
+	assert.Nil(t, rotated.Get(ctx, "old", &value))
+	assert.DeepEqual(t, "v1", value)
+
+	assert.Nil(t, rotated.Set(ctx, "new", "v2", time.Minute))
+	var payload []byte
+	assert.Nil(t, memoryStore.Get(ctx, "new", &payload))
+	assert.DeepEqual(t, byte(2), payload[1])
+
+	// once the key is removed, its entries are misses
+	removed, err := NewKeyring(2, map[byte][]byte{2: bytes.Repeat([]byte{2}, 16)})
+	assert.Nil(t, err)
+	err = NewEncryptedStore(memoryStore, removed).Get(ctx, "old", &value)
+	assert.True(t, errors.Is(err, ErrCacheMiss))
+	assert.True(t, errors.Is(err, ErrDecryption))
+}
+
+func TestEncryptedStoreTampered(t *testing.T) {
+	ctx := context.Background()
+	memoryStore := NewMemoryStore(time.Minute)
+	store := NewEncryptedStore(memoryStore, newTestKeyring(t, 1))
+	assert.Nil(t, store.Set(ctx, "key", "value", time.Minute))
+
+	var payload []byte
+	assert.Nil(t, memoryStore.Get(ctx, "key", &payload))
+	tampered := append([]byte{}, payload...)
+	tampered[len(tampered)-1] ^= 1
+	value := ""
+	for key, payload := range map[string][]byte{
+		"tampered":  tampered,
+		"truncated": payload[:10],
+		"plain":     []byte("plain"),
+	} {
+		assert.Nil(t, memoryStore.Set(ctx, key, payload, time.Minute))
+		err := store.Get(ctx, key, &value)
+		assert.True(t, errors.Is(err, ErrCacheMiss))
+		assert.True(t, errors.Is(err, ErrDecryption))
+	}
+
+	// an entry moved to another key fails to authenticate
+	assert.Nil(t, memoryStore.Set(ctx, "moved", payload, time.Minute))
+	assert.True(t, errors.Is(store.Get(ctx, "moved", &value), ErrDecryption))
+}
+
+func TestEncryptedStoreKeyHMACFencing(t *testing.T) {
+	ctx := context.Background()
+	for _, client := range []redis.UniversalClient{
+		redis.NewClient(&redis.Options{Addr: "127.0.0.1:6379"}),
+		redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{"127.0.0.1:6379"}}),
+	} {
+		store := NewEncryptedStore(NewRedisStore(client), newTestKeyring(t, 1), WithKeyHMAC([]byte("secret")))
+		locker := NewRedisLocker(client)
+
+		// the lock is on the cache key while the entry is stored under its HMAC
+		stale, err := locker.Obtain(ctx, "test-encrypted-fenced", 10*time.Millisecond)
+		assert.Nil(t, err)
+		time.Sleep(20 * time.Millisecond)
+		current, err := locker.Obtain(ctx, "test-encrypted-fenced", time.Second)
+		assert.Nil(t, err)
+
+		assert.Nil(t, store.Set(WithLockToken(ctx, current.Token()), "test-encrypted-fenced", "current", time.Minute))
+		assert.DeepEqual(t, ErrStaleLockToken, store.Set(WithLockToken(ctx, stale.Token()), "test-encrypted-fenced", "stale", time.Minute))
+		value := ""
+		assert.Nil(t, store.Get(ctx, "test-encrypted-fenced", &value))
+		assert.DeepEqual(t, "current", value)
+
+		assert.Nil(t, current.Release(ctx))
+		assert.Nil(t, store.Delete(ctx, "test-encrypted-fenced"))
+		assert.Nil(t, store.Close())
+	}
+}
+
+func TestNewEncryptedStoreInvalidKeyring(t *testing.T) {
+	assertPanics := func(keyring *Keyring) {
+		defer func() {
+			assert.True(t, recover() != nil)
+		}()
+		NewEncryptedStore(NewMemoryStore(time.Minute), keyring)
+	}
+	assertPanics(nil)
+	assertPanics(&Keyring{})
+}
@@ -0,0 +1,160 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package persist
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"reflect"
+)
+
+const (
+	// envelopeMagic marks the payloads wrapped in an envelope
+	envelopeMagic byte = 0xCD
+	// envelopeVersion the version of the envelope format itself
+	envelopeVersion byte = 1
+)
+
+var (
+	// ErrSchemaMismatch represent the payload is written for another type or another schema version of the type.
+	// The store returns it as a miss carrying the cause, errors.Is(err, ErrCacheMiss) is true.
+	ErrSchemaMismatch = errors.New("persist schema mismatch")
+	// ErrChecksumMismatch represent the payload is corrupted.
+	// The store returns it as a miss carrying the cause, errors.Is(err, ErrCacheMiss) is true.
+	ErrChecksumMismatch = errors.New("persist checksum mismatch")
+)
+
+// Versioned is implemented by the types whose encoding changes across releases,
+// the payloads written with another schema version are misses instead of decoding into garbage.
+// The method is looked up on the pointer to the type.
+type Versioned interface {
+	SchemaVersion() uint32
+}
+
+// schemaOf returns the identity and the schema version of t, the pointers are dereferenced
+// so that a *T written is read into a **T or a *T alike
+func schemaOf(t reflect.Type) (string, uint32) {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil {
+		return "", 0
+	}
+
+	identity := t.String()
+	if t.Name() != "" && t.PkgPath() != "" {
+		identity = t.PkgPath() + "." + t.Name()
+	}
+	var version uint32
+	if v, ok := reflect.New(t).Interface().(Versioned); ok {
+		version = v.SchemaVersion()
+	}
+	return identity, version
+}
+
+// sealEnvelope wraps the payload of value with the envelope version, the schema version and identity of its type,
+// and the crc32 of the payload
+func sealEnvelope(value interface{}, payload []byte) []byte {
+	identity, version := schemaOf(reflect.TypeOf(value))
+
+	sealed := make([]byte, 0, 2+2*binary.MaxVarintLen32+len(identity)+crc32.Size+len(payload))
+	sealed = append(sealed, envelopeMagic, envelopeVersion)
+	sealed = appendUvarint(sealed, uint64(version))
+	sealed = appendUvarint(sealed, uint64(len(identity)))
+	sealed = append(sealed, identity...)
+	var checksum [crc32.Size]byte
+	binary.BigEndian.PutUint32(checksum[:], crc32.ChecksumIEEE(payload))
+	sealed = append(sealed, checksum[:]...)
+	return append(sealed, payload...)
+}
+
+// openEnvelope verifies the envelope against the type ptr points to, and returns the payload inside.
+// The payloads without envelope are written by the previous releases and returned as is.
+func openEnvelope(sealed []byte, ptr interface{}) ([]byte, error) {
+	if len(sealed) < 2 || sealed[0] != envelopeMagic {
+		return sealed, nil
+	}
+	if sealed[1] != envelopeVersion {
+		return nil, mismatchError(ErrSchemaMismatch, "envelope version %d", sealed[1])
+	}
+
+	buf := sealed[2:]
+	version, n := binary.Uvarint(buf)
+	if n <= 0 {
+		return nil, mismatchError(ErrChecksumMismatch, "truncated envelope")
+	}
+	buf = buf[n:]
+	size, n := binary.Uvarint(buf)
+	// compare without adding to size, which can be large enough to overflow
+	if n <= 0 || size > uint64(len(buf)-n) {
+		return nil, mismatchError(ErrChecksumMismatch, "truncated envelope")
+	}
+	identity := string(buf[n : n+int(size)])
+	buf = buf[n+int(size):]
+	if len(buf) < crc32.Size {
+		return nil, mismatchError(ErrChecksumMismatch, "truncated envelope")
+	}
+
+	expectedIdentity, expectedVersion := schemaOf(reflect.TypeOf(ptr))
+	if identity != expectedIdentity || uint32(version) != expectedVersion {
+		return nil, mismatchError(ErrSchemaMismatch, "%s version %d, expected %s version %d",
+			identity, version, expectedIdentity, expectedVersion)
+	}
+
+	payload := buf[crc32.Size:]
+	if binary.BigEndian.Uint32(buf) != crc32.ChecksumIEEE(payload) {
+		return nil, mismatchError(ErrChecksumMismatch, "crc32 %08x", binary.BigEndian.Uint32(buf))
+	}
+	return payload, nil
+}
+
+// mismatchError returns a StoreError of kind wrapping ErrCacheMiss, so that the entry is regenerated
+func mismatchError(kind error, format string, args ...interface{}) error {
+	return &StoreError{Op: opGet, Kind: kind, Err: fmt.Errorf("%w: "+format, append([]interface{}{ErrCacheMiss}, args...)...)}
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var scratch [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(scratch[:], v)
+	return append(buf, scratch[:n]...)
+}
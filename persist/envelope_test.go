@@ -0,0 +1,161 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package persist
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/go-redis/redis/v8"
+)
+
+type versionedV1 struct {
+	A int
+}
+
+func (*versionedV1) SchemaVersion() uint32 {
+	return 1
+}
+
+type versionedV2 struct {
+	A int
+}
+
+func (*versionedV2) SchemaVersion() uint32 {
+	return 2
+}
+
+func TestSchemaOf(t *testing.T) {
+	identity, version := schemaOf(reflect.TypeOf(&versionedV1{}))
+	assert.DeepEqual(t, "github.com/hertz-contrib/cache/persist.versionedV1", identity)
+	assert.DeepEqual(t, uint32(1), version)
+
+	var ptr *versionedV1
+	identity2, version2 := schemaOf(reflect.TypeOf(&ptr))
+	assert.DeepEqual(t, identity, identity2)
+	assert.DeepEqual(t, version, version2)
+
+	identity, version = schemaOf(reflect.TypeOf([]string{}))
+	assert.DeepEqual(t, "[]string", identity)
+	assert.DeepEqual(t, uint32(0), version)
+}
+
+func TestEnvelope(t *testing.T) {
+	sealed := sealEnvelope(&versionedV1{A: 1}, []byte("payload"))
+
+	var v1 *versionedV1
+	payload, err := openEnvelope(sealed, &v1)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, []byte("payload"), payload)
+
+	// another schema version of the type
+	var v2 *versionedV2
+	_, err = openEnvelope(sealed, &v2)
+	assert.True(t, errors.Is(err, ErrSchemaMismatch))
+	assert.True(t, errors.Is(err, ErrCacheMiss))
+
+	// another type
+	var s string
+	_, err = openEnvelope(sealed, &s)
+	assert.True(t, errors.Is(err, ErrSchemaMismatch))
+
+	// corrupted
+	corrupted := append([]byte{}, sealed...)
+	corrupted[len(corrupted)-1] ^= 1
+	_, err = openEnvelope(corrupted, &v1)
+	assert.True(t, errors.Is(err, ErrChecksumMismatch))
+	assert.True(t, errors.Is(err, ErrCacheMiss))
+	_, err = openEnvelope(sealed[:10], &v1)
+	assert.True(t, errors.Is(err, ErrChecksumMismatch))
+
+	// the payloads without envelope are returned as is
+	payload, err = openEnvelope([]byte{payloadMagic, CodecIDGob}, &v1)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, []byte{payloadMagic, CodecIDGob}, payload)
+}
+
+func TestRedisStoreDeleteOnMismatch(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "127.0.0.1:6379",
+	})
+	ctx := context.Background()
+	defer client.Del(ctx, "test-mismatch")
+
+	for _, deleteOnMismatch := range []bool{false, true} {
+		store := NewRedisStore(client, WithDeleteOnMismatch(deleteOnMismatch))
+		assert.Nil(t, store.Set(ctx, "test-mismatch", &versionedV1{A: 1}, time.Minute))
+
+		var v1 *versionedV1
+		assert.Nil(t, store.Get(ctx, "test-mismatch", &v1))
+		assert.DeepEqual(t, 1, v1.A)
+
+		// a release reading the entry with another schema version
+		var v2 *versionedV2
+		err := store.Get(ctx, "test-mismatch", &v2)
+		assert.True(t, errors.Is(err, ErrSchemaMismatch))
+		assert.True(t, errors.Is(err, ErrCacheMiss))
+		assert.DeepEqual(t, !deleteOnMismatch, client.Exists(ctx, "test-mismatch").Val() == 1)
+	}
+}
+
+func FuzzOpenEnvelope(f *testing.F) {
+	f.Add(sealEnvelope(&versionedV1{}, []byte("payload")))
+	f.Add(sealEnvelope(&versionedV2{}, nil))
+	// an identity length overflowing when added to the checksum size
+	f.Add([]byte{envelopeMagic, envelopeVersion, 1, 0xfc, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01, 'a', 'b'})
+
+	f.Fuzz(func(t *testing.T, sealed []byte) {
+		payload, err := openEnvelope(sealed, &versionedV1{})
+		if err != nil {
+			if !errors.Is(err, ErrCacheMiss) || !(errors.Is(err, ErrChecksumMismatch) || errors.Is(err, ErrSchemaMismatch)) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			return
+		}
+		if len(payload) > len(sealed) {
+			t.Fatalf("payload of %d bytes opened from %d bytes", len(payload), len(sealed))
+		}
+	})
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package persist
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+)
+
+var (
+	// ErrConnection represent the cache store can not be connected
+	ErrConnection = errors.New("persist connection error")
+	// ErrTimeout represent the cache store operation timed out
+	ErrTimeout = errors.New("persist timeout error")
+	// ErrSerialization represent the value can not be serialized or deserialized
+	ErrSerialization = errors.New("persist serialization error")
+)
+
+// StoreError is the error returned by the cache stores, use errors.Is with
+// ErrConnection, ErrTimeout, ErrSerialization or ErrDecryption to find out the kind of the failure
+type StoreError struct {
+	// Op the store operation, e.g. get, set or delete
+	Op string
+	// Kind one of ErrConnection, ErrTimeout, ErrSerialization and ErrDecryption, nil if unknown
+	Kind error
+	// Err the underlying error
+	Err error
+}
+
+func (e *StoreError) Error() string {
+	if e.Kind == nil {
+		return "persist " + e.Op + ": " + e.Err.Error()
+	}
+	return "persist " + e.Op + ": " + e.Kind.Error() + ": " + e.Err.Error()
+}
+
+func (e *StoreError) Unwrap() error {
+	return e.Err
+}
+
+func (e *StoreError) Is(target error) bool {
+	return e.Kind != nil && e.Kind == target
+}
+
+// NewSerializationError wraps the error of encoding or decoding a value
+func NewSerializationError(op string, err error) error {
+	return &StoreError{Op: op, Kind: ErrSerialization, Err: err}
+}
+
+// WrapError classifies err into a StoreError, nil and ErrCacheMiss are returned as is
+func WrapError(op string, err error) error {
+	if err == nil || errors.Is(err, ErrCacheMiss) {
+		return err
+	}
+
+	var storeErr *StoreError
+	if errors.As(err, &storeErr) {
+		return err
+	}
+
+	return &StoreError{Op: op, Kind: classifyError(err), Err: err}
+}
+
+func classifyError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrTimeout
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrTimeout
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed) {
+		return ErrConnection
+	}
+
+	return nil
+}
@@ -0,0 +1,199 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package persist
+
+import (
+	"container/heap"
+)
+
+// EvictionPolicy decides the entry to evict when a bounded MemoryStore is full
+type EvictionPolicy int
+
+const (
+	// EvictionLRU evicts the least recently used entry
+	EvictionLRU EvictionPolicy = iota
+	// EvictionLFU evicts the least frequently used entry, the least recently used one among the ties
+	EvictionLFU
+)
+
+func (p EvictionPolicy) String() string {
+	switch p {
+	case EvictionLRU:
+		return "lru"
+	case EvictionLFU:
+		return "lfu"
+	}
+	return "unknown"
+}
+
+// Sized is implemented by the values reporting their size in bytes to a bounded MemoryStore
+type Sized interface {
+	Size() int
+}
+
+// defaultSizer returns the size of Sized values, []byte and string, 0 for the others
+func defaultSizer(value interface{}) int64 {
+	switch v := value.(type) {
+	case Sized:
+		return int64(v.Size())
+	case []byte:
+		return int64(len(v))
+	case string:
+		return int64(len(v))
+	}
+	return 0
+}
+
+type trackedEntry struct {
+	key   string
+	value interface{}
+	size  int64
+	freq  uint64
+	tick  uint64
+	index int
+}
+
+// evictionTracker orders the entries of a bounded MemoryStore by the eviction policy, it is not concurrency safe
+type evictionTracker struct {
+	policy  EvictionPolicy
+	entries map[string]*trackedEntry
+	heap    []*trackedEntry
+	bytes   int64
+	tick    uint64
+}
+
+func newEvictionTracker(policy EvictionPolicy) *evictionTracker {
+	return &evictionTracker{
+		policy:  policy,
+		entries: make(map[string]*trackedEntry),
+	}
+}
+
+// set tracks a new entry or updates an existing one, which counts as a use
+func (t *evictionTracker) set(key string, value interface{}, size int64) {
+	t.tick++
+	if e, ok := t.entries[key]; ok {
+		t.bytes += size - e.size
+		e.value, e.size = value, size
+		e.freq++
+		e.tick = t.tick
+		heap.Fix(t, e.index)
+		return
+	}
+
+	e := &trackedEntry{key: key, value: value, size: size, freq: 1, tick: t.tick}
+	t.entries[key] = e
+	t.bytes += size
+	heap.Push(t, e)
+}
+
+func (t *evictionTracker) touch(key string) {
+	e, ok := t.entries[key]
+	if !ok {
+		return
+	}
+	t.tick++
+	e.freq++
+	e.tick = t.tick
+	heap.Fix(t, e.index)
+}
+
+func (t *evictionTracker) remove(key string) {
+	e, ok := t.entries[key]
+	if !ok {
+		return
+	}
+	heap.Remove(t, e.index)
+	delete(t.entries, key)
+	t.bytes -= e.size
+}
+
+// victim returns the entry to evict next except key, so that an entry just set is not evicted by LFU
+// for its frequency of one
+func (t *evictionTracker) victim(except string) (*trackedEntry, bool) {
+	if len(t.heap) == 0 {
+		return nil, false
+	}
+	if t.heap[0].key != except {
+		return t.heap[0], true
+	}
+
+	// the next one is the least of the children of the root
+	switch {
+	case len(t.heap) == 1:
+		return nil, false
+	case len(t.heap) == 2 || t.Less(1, 2):
+		return t.heap[1], true
+	}
+	return t.heap[2], true
+}
+
+func (t *evictionTracker) Len() int {
+	return len(t.heap)
+}
+
+func (t *evictionTracker) Less(i, j int) bool {
+	a, b := t.heap[i], t.heap[j]
+	if t.policy == EvictionLFU && a.freq != b.freq {
+		return a.freq < b.freq
+	}
+	return a.tick < b.tick
+}
+
+func (t *evictionTracker) Swap(i, j int) {
+	t.heap[i], t.heap[j] = t.heap[j], t.heap[i]
+	t.heap[i].index = i
+	t.heap[j].index = j
+}
+
+func (t *evictionTracker) Push(x interface{}) {
+	e := x.(*trackedEntry)
+	e.index = len(t.heap)
+	t.heap = append(t.heap, e)
+}
+
+func (t *evictionTracker) Pop() interface{} {
+	n := len(t.heap)
+	e := t.heap[n-1]
+	t.heap[n-1] = nil
+	t.heap = t.heap[:n-1]
+	return e
+}
@@ -0,0 +1,95 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package persist
+
+import (
+	"reflect"
+)
+
+// IsolationMode decides whether the readers of a MemoryStore share the stored values
+type IsolationMode int
+
+const (
+	// IsolationShared the readers get the stored value itself, e.g. the same *ResponseCache,
+	// so a reader mutating it changes the entry for all the others
+	IsolationShared IsolationMode = iota
+	// IsolationCopy the readers get a deep copy of the stored value, made by its Clone method
+	// returning the same type if any, otherwise by an encoding round trip
+	IsolationCopy
+	// IsolationSerialize the values are stored encoded like in RedisStore and decoded on every read
+	IsolationSerialize
+)
+
+func (m IsolationMode) String() string {
+	switch m {
+	case IsolationShared:
+		return "shared"
+	case IsolationCopy:
+		return "copy"
+	case IsolationSerialize:
+		return "serialize"
+	}
+	return "unknown"
+}
+
+// cloneValue returns a deep copy of value
+func cloneValue(value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	v := reflect.ValueOf(value)
+	if method := v.MethodByName("Clone"); method.IsValid() {
+		if t := method.Type(); t.NumIn() == 0 && t.NumOut() == 1 && t.Out(0) == v.Type() {
+			return method.Call(nil)[0].Interface(), nil
+		}
+	}
+
+	payload, err := encodePayload(codecFor(nil, value), value)
+	if err != nil {
+		return nil, err
+	}
+	ptr := reflect.New(v.Type())
+	if err := decodePayload(payload, ptr.Interface()); err != nil {
+		return nil, err
+	}
+	return ptr.Elem().Interface(), nil
+}
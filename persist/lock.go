@@ -0,0 +1,212 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package persist
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	// ErrLockNotObtained represent the lock is held by another owner
+	ErrLockNotObtained = errors.New("persist lock not obtained")
+	// ErrStaleLockToken represent the write is rejected, as a newer lock was obtained on the key after the writer's one
+	ErrStaleLockToken = errors.New("persist stale lock token")
+)
+
+// fenceTTLMultiple the fencing token key of RedisLocker expires after this number of lock TTLs without a new lock,
+// the writers whose lock expired longer ago are not fenced anymore
+const fenceTTLMultiple = 10
+
+// Locker obtains distributed locks, so that only one instance regenerates a key at the same time
+type Locker interface {
+	// Obtain tries once to obtain the lock of key which expires after ttl,
+	// returns ErrLockNotObtained if the lock is held by another owner
+	Obtain(ctx context.Context, key string, ttl time.Duration) (Lock, error)
+}
+
+// Lock is an obtained distributed lock
+type Lock interface {
+	// Token returns the fencing token, which increases for every lock obtained on the same key
+	Token() int64
+	// Release releases the lock, does nothing if the lock has expired and is owned by another one
+	Release(ctx context.Context) error
+}
+
+type lockTokenKey struct{}
+
+type lockedKeyKey struct{}
+
+// WithLockToken returns a context carrying the fencing token of the lock held by the writer
+func WithLockToken(ctx context.Context, token int64) context.Context {
+	return context.WithValue(ctx, lockTokenKey{}, token)
+}
+
+// LockToken returns the fencing token carried by ctx, stores can use it to reject stale writers.
+// RedisStore rejects the writes whose token is older than the last lock obtained with RedisLocker on the key.
+func LockToken(ctx context.Context) (int64, bool) {
+	token, ok := ctx.Value(lockTokenKey{}).(int64)
+	return token, ok
+}
+
+var (
+	// obtainScript sets the lock if absent and sets the fencing token, which expires after ARGV[3] milliseconds.
+	// The token is the server time in microseconds and above the previous one, so that it keeps increasing
+	// after the fencing token key expired.
+	obtainScript = redis.NewScript(`
+if redis.replicate_commands then
+	redis.replicate_commands()
+end
+if redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+	local now = redis.call("TIME")
+	local token = tonumber(now[1]) * 1000000 + tonumber(now[2])
+	local fence = tonumber(redis.call("GET", KEYS[2]))
+	if fence and fence >= token then
+		token = fence + 1
+	end
+	redis.call("SET", KEYS[2], string.format("%d", token), "PX", ARGV[3])
+	return token
+end
+return 0
+`)
+
+	// releaseScript deletes the lock only if it is still owned
+	releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+)
+
+// RedisLocker implements Locker with redis SET NX PX
+type RedisLocker struct {
+	RedisClient redis.UniversalClient
+}
+
+// NewRedisLocker create a redis locker with redis client, which can be a *redis.Client,
+// a *redis.ClusterClient, a *redis.Ring or a failover client of sentinel
+func NewRedisLocker(redisClient redis.UniversalClient) *RedisLocker {
+	return &RedisLocker{
+		RedisClient: redisClient,
+	}
+}
+
+// Obtain sets the lock key if absent and increases the fencing token key in one script.
+// Both keys share the hash tag of key so that they are in the same slot of a redis cluster as key.
+// The fencing token key expires after 10 lock TTLs without a new lock, so that it does not stay forever,
+// and the tokens are derived from the server time so that they never go back once it expired.
+func (l *RedisLocker) Obtain(ctx context.Context, key string, ttl time.Duration) (Lock, error) {
+	owner, err := randomOwner()
+	if err != nil {
+		return nil, err
+	}
+
+	lockKey := lockKeyOf(key)
+	keys := []string{lockKey, fenceKeyOf(key)}
+	ttlMillis := ttl.Milliseconds()
+	token, err := obtainScript.Run(ctx, l.RedisClient, keys, owner, ttlMillis, ttlMillis*fenceTTLMultiple).Int64()
+	if err != nil {
+		return nil, WrapError(opLock, err)
+	}
+	if token == 0 {
+		return nil, ErrLockNotObtained
+	}
+
+	return &redisLock{
+		client: l.RedisClient,
+		key:    lockKey,
+		owner:  owner,
+		token:  token,
+	}, nil
+}
+
+type redisLock struct {
+	client redis.UniversalClient
+	key    string
+	owner  string
+	token  int64
+}
+
+func (l *redisLock) Token() int64 {
+	return l.token
+}
+
+func (l *redisLock) Release(ctx context.Context) error {
+	return WrapError(opUnlock, releaseScript.Run(ctx, l.client, []string{l.key}, l.owner).Err())
+}
+
+// withLockedKey returns a context telling the underlying store that the value written under a mapped storage key,
+// e.g. the HMAC of EncryptedStore, is the one of key, whose fencing token applies
+func withLockedKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, lockedKeyKey{}, key)
+}
+
+// lockedKeyOf returns the key locked for the write of storageKey, and whether it differs from storageKey
+func lockedKeyOf(ctx context.Context, storageKey string) (string, bool) {
+	if key, ok := ctx.Value(lockedKeyKey{}).(string); ok && key != storageKey {
+		return key, true
+	}
+	return storageKey, false
+}
+
+// lockKeyOf returns the lock key of RedisLocker for key
+func lockKeyOf(key string) string {
+	return "lock:" + HashTag(key)
+}
+
+// fenceKeyOf returns the fencing token key of RedisLocker for key
+func fenceKeyOf(key string) string {
+	return lockKeyOf(key) + ":fence"
+}
+
+func randomOwner() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,162 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package persist
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestRedisLocker(t *testing.T) {
+	locker := NewRedisLocker(redis.NewClient(&redis.Options{
+		Addr: "127.0.0.1:6379",
+	}))
+
+	ctx := context.Background()
+	lock, err := locker.Obtain(ctx, "test-lock", time.Second)
+	assert.Nil(t, err)
+
+	_, err = locker.Obtain(ctx, "test-lock", time.Second)
+	assert.DeepEqual(t, ErrLockNotObtained, err)
+
+	assert.Nil(t, lock.Release(ctx))
+	lock2, err := locker.Obtain(ctx, "test-lock", 100*time.Millisecond)
+	assert.Nil(t, err)
+	assert.True(t, lock2.Token() > lock.Token())
+
+	// the expired lock can be obtained by another owner, and is not released by the previous one
+	time.Sleep(200 * time.Millisecond)
+	lock3, err := locker.Obtain(ctx, "test-lock", time.Second)
+	assert.Nil(t, err)
+	assert.Nil(t, lock2.Release(ctx))
+	_, err = locker.Obtain(ctx, "test-lock", time.Second)
+	assert.DeepEqual(t, ErrLockNotObtained, err)
+	assert.Nil(t, lock3.Release(ctx))
+}
+
+func TestLockToken(t *testing.T) {
+	_, ok := LockToken(context.Background())
+	assert.False(t, ok)
+
+	token, ok := LockToken(WithLockToken(context.Background(), 42))
+	assert.True(t, ok)
+	assert.DeepEqual(t, int64(42), token)
+}
+
+func TestRedisLockerFenceExpires(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "127.0.0.1:6379",
+	})
+	defer client.Close()
+	ctx := context.Background()
+
+	lock, err := NewRedisLocker(client).Obtain(ctx, "test-lock-fence", time.Second)
+	assert.Nil(t, err)
+	defer lock.Release(ctx)
+
+	ttl, err := client.PTTL(ctx, fenceKeyOf("test-lock-fence")).Result()
+	assert.Nil(t, err)
+	assert.True(t, ttl > time.Second && ttl <= fenceTTLMultiple*time.Second)
+}
+
+func TestRedisStoreFencedSet(t *testing.T) {
+	ctx := context.Background()
+	for _, client := range map[string]redis.UniversalClient{
+		"client":  redis.NewClient(&redis.Options{Addr: "127.0.0.1:6379"}),
+		"cluster": redis.NewClusterClient(&redis.ClusterOptions{Addrs: []string{"127.0.0.1:6379"}}),
+	} {
+		store := NewRedisStore(client)
+		locker := NewRedisLocker(client)
+		// the last key can not be tagged in its own slot
+		for _, key := range []string{"test-fenced", "{test}-fenced", "test}-fenced"} {
+			stale, err := locker.Obtain(ctx, key, 10*time.Millisecond)
+			assert.Nil(t, err)
+			time.Sleep(20 * time.Millisecond)
+			current, err := locker.Obtain(ctx, key, time.Second)
+			assert.Nil(t, err)
+
+			// the holder whose lock expired can not overwrite the response of the current holder
+			assert.Nil(t, store.Set(WithLockToken(ctx, current.Token()), key, "current", time.Minute))
+			assert.DeepEqual(t, ErrStaleLockToken, store.Set(WithLockToken(ctx, stale.Token()), key, "stale", time.Minute))
+			value := ""
+			assert.Nil(t, store.Get(ctx, key, &value))
+			assert.DeepEqual(t, "current", value)
+
+			ttl, err := client.PTTL(ctx, key).Result()
+			assert.Nil(t, err)
+			assert.True(t, ttl > 0 && ttl <= time.Minute)
+
+			assert.Nil(t, current.Release(ctx))
+			assert.Nil(t, store.Delete(ctx, key))
+		}
+		assert.Nil(t, store.Close())
+	}
+}
+
+func TestRedisLockerTokenAfterFenceExpired(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "127.0.0.1:6379",
+	})
+	defer client.Close()
+	ctx := context.Background()
+	locker := NewRedisLocker(client)
+
+	stale, err := locker.Obtain(ctx, "test-lock-monotonic", 10*time.Millisecond)
+	assert.Nil(t, err)
+	// the lock and its fencing token key expire
+	time.Sleep(fenceTTLMultiple*10*time.Millisecond + 50*time.Millisecond)
+	assert.DeepEqual(t, int64(0), client.Exists(ctx, fenceKeyOf("test-lock-monotonic")).Val())
+
+	current, err := locker.Obtain(ctx, "test-lock-monotonic", time.Second)
+	assert.Nil(t, err)
+	defer current.Release(ctx)
+	assert.True(t, current.Token() > stale.Token())
+
+	// the holder from before the expiration is still fenced
+	store := NewRedisStore(client)
+	assert.Nil(t, store.Set(WithLockToken(ctx, current.Token()), "test-lock-monotonic", "current", time.Minute))
+	assert.DeepEqual(t, ErrStaleLockToken, store.Set(WithLockToken(ctx, stale.Token()), "test-lock-monotonic", "stale", time.Minute))
+	assert.Nil(t, store.Delete(ctx, "test-lock-monotonic"))
+}
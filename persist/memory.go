@@ -43,7 +43,9 @@ package persist
 import (
 	"context"
 	"errors"
+	"fmt"
 	"reflect"
+	"sync"
 	"time"
 
 	"github.com/cloudwego/hertz/pkg/common/hlog"
@@ -52,15 +54,123 @@ import (
 
 const (
 	setTTLErrorFormat = "[CACHE] set ttl for memory store error: %s"
+	evictErrorFormat  = "[CACHE] evict memory store entry error: %s, cache key: %s"
 )
 
+var (
+	// ErrEntryTooLarge represent the value exceeds the max bytes of a bounded MemoryStore by itself
+	ErrEntryTooLarge = errors.New("persist entry too large")
+	// ErrTypeMismatch represent the stored value can not be assigned to the destination, see TypeMismatchError
+	ErrTypeMismatch = errors.New("persist type mismatch")
+)
+
+// TypeMismatchError is returned by MemoryStore.Get when the stored value can not be assigned to the destination,
+// errors.Is(err, ErrTypeMismatch) is true
+type TypeMismatchError struct {
+	Key string
+	// Stored the type of the stored value
+	Stored reflect.Type
+	// Target the type of the destination
+	Target reflect.Type
+}
+
+func (e *TypeMismatchError) Error() string {
+	return fmt.Sprintf("%s: stored %v can not be assigned to %v, cache key: %s", ErrTypeMismatch, e.Stored, e.Target, e.Key)
+}
+
+func (e *TypeMismatchError) Is(target error) bool {
+	return target == ErrTypeMismatch
+}
+
+// MemoryStoreOptions contains the options of MemoryStore
+type MemoryStoreOptions struct {
+	// MaxEntries the maximum number of entries, zero means unlimited
+	MaxEntries int
+	// MaxBytes the maximum total size of the values, zero means unlimited
+	MaxBytes int64
+	// Sizer returns the size of a value, default handles Sized, []byte and string, and returns 0 for the others
+	Sizer func(value interface{}) int64
+	// Eviction the policy to evict the entries when the store is full
+	Eviction EvictionPolicy
+	// OnEvict will be called when an entry is evicted to make room, not when it expires or is deleted.
+	// The value is as stored, i.e. the encoded payload with IsolationSerialize.
+	OnEvict func(key string, value interface{})
+	// Isolation decides whether the readers share the stored values
+	Isolation IsolationMode
+}
+
+// MemoryStoreOption represents the optional function of MemoryStore.
+type MemoryStoreOption struct {
+	F func(o *MemoryStoreOptions)
+}
+
+// WithMaxEntries bounds the number of entries, the entries are evicted by the eviction policy beyond it
+func WithMaxEntries(n int) MemoryStoreOption {
+	return MemoryStoreOption{F: func(o *MemoryStoreOptions) {
+		o.MaxEntries = n
+	}}
+}
+
+// WithMaxBytes bounds the total size of the values, the entries are evicted by the eviction policy beyond it
+func WithMaxBytes(n int64) MemoryStoreOption {
+	return MemoryStoreOption{F: func(o *MemoryStoreOptions) {
+		o.MaxBytes = n
+	}}
+}
+
+// WithSizer set up the function returning the size of a value, the *ResponseCache of the middleware
+// report their payload size without it
+func WithSizer(sizer func(value interface{}) int64) MemoryStoreOption {
+	return MemoryStoreOption{F: func(o *MemoryStoreOptions) {
+		o.Sizer = sizer
+	}}
+}
+
+// WithEvictionPolicy set up the policy to evict the entries when the store is full, default is EvictionLRU
+func WithEvictionPolicy(policy EvictionPolicy) MemoryStoreOption {
+	return MemoryStoreOption{F: func(o *MemoryStoreOptions) {
+		o.Eviction = policy
+	}}
+}
+
+// WithOnEvict set up the callback when an entry is evicted to make room
+func WithOnEvict(cb func(key string, value interface{})) MemoryStoreOption {
+	return MemoryStoreOption{F: func(o *MemoryStoreOptions) {
+		o.OnEvict = cb
+	}}
+}
+
+// WithIsolation set up whether the readers share the stored values, default is IsolationShared.
+// Isolate the values if the readers mutate them, e.g. the headers of the cached response
+// in a BeforeReplyWithCacheCallback.
+func WithIsolation(mode IsolationMode) MemoryStoreOption {
+	return MemoryStoreOption{F: func(o *MemoryStoreOptions) {
+		o.Isolation = mode
+	}}
+}
+
+// MemoryStoreStats the counters of a bounded MemoryStore
+type MemoryStoreStats struct {
+	// Entries the number of entries tracked for eviction
+	Entries int
+	// Bytes the total size of the tracked values
+	Bytes int64
+	// Evictions the number of entries evicted to make room
+	Evictions uint64
+}
+
 // MemoryStore local memory cache store
 type MemoryStore struct {
 	Cache *ttlcache.Cache
+
+	options   MemoryStoreOptions
+	mu        sync.Mutex
+	tracker   *evictionTracker
+	evictions uint64
 }
 
 // NewMemoryStore allocate a local memory store with default expiration
-func NewMemoryStore(defaultExpiration time.Duration) *MemoryStore {
+func NewMemoryStore(defaultExpiration time.Duration, opts ...MemoryStoreOption) *MemoryStore {
 	cacheStore := ttlcache.NewCache()
 	if err := cacheStore.SetTTL(defaultExpiration); err != nil {
 		hlog.Errorf(setTTLErrorFormat, err)
@@ -69,29 +179,204 @@ func NewMemoryStore(defaultExpiration time.Duration) *MemoryStore {
 	// disable SkipTTLExtensionOnHit default
 	cacheStore.SkipTTLExtensionOnHit(true)
 
-	return &MemoryStore{
-		Cache: cacheStore,
+	options := MemoryStoreOptions{
+		Sizer: defaultSizer,
 	}
+	for _, opt := range opts {
+		opt.F(&options)
+	}
+
+	store := &MemoryStore{
+		Cache:   cacheStore,
+		options: options,
+	}
+	if store.bounded() {
+		store.tracker = newEvictionTracker(options.Eviction)
+		cacheStore.SetExpirationReasonCallback(store.untrack)
+	}
+	return store
 }
 
-// Set put key value pair to memory store, and expire after expireDuration
+func (c *MemoryStore) bounded() bool {
+	return c.options.MaxEntries > 0 || c.options.MaxBytes > 0
+}
+
+// untrack is called asynchronously by ttlcache once an entry is removed, the key is kept
+// tracked if it has been set again in the meantime
+func (c *MemoryStore) untrack(key string, reason ttlcache.EvictionReason, value interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.Cache.Get(key); errors.Is(err, ttlcache.ErrNotFound) {
+		c.tracker.remove(key)
+	}
+}
+
+// Set put key value pair to memory store, and expire after expireDuration.
+// A bounded store evicts the entries by the eviction policy to make room.
 func (c *MemoryStore) Set(ctx context.Context, key string, value interface{}, expireDuration time.Duration) error {
-	return c.Cache.SetWithTTL(key, value, expireDuration)
+	stored := value
+	if c.options.Isolation == IsolationSerialize {
+		payload, err := encodePayload(codecFor(nil, value), value)
+		if err != nil {
+			return NewSerializationError(opSet, err)
+		}
+		stored = payload
+	}
+
+	if !c.bounded() {
+		return WrapError(opSet, c.Cache.SetWithTTL(key, stored, expireDuration))
+	}
+
+	size := c.options.Sizer(value)
+	if c.options.MaxBytes > 0 && size > c.options.MaxBytes {
+		return ErrEntryTooLarge
+	}
+
+	c.mu.Lock()
+	if err := c.Cache.SetWithTTL(key, stored, expireDuration); err != nil {
+		c.mu.Unlock()
+		return WrapError(opSet, err)
+	}
+	c.tracker.set(key, stored, size)
+
+	var evicted []*trackedEntry
+	for c.full() {
+		victim, ok := c.tracker.victim(key)
+		if !ok {
+			break
+		}
+		c.tracker.remove(victim.key)
+		if err := c.Cache.Remove(victim.key); err != nil && !errors.Is(err, ttlcache.ErrNotFound) {
+			hlog.CtxErrorf(ctx, evictErrorFormat, err, victim.key)
+		}
+		c.evictions++
+		evicted = append(evicted, victim)
+	}
+	c.mu.Unlock()
+
+	// notify outside the lock, so that the callback may use the store
+	if c.options.OnEvict != nil {
+		for _, e := range evicted {
+			c.options.OnEvict(e.key, e.value)
+		}
+	}
+	return nil
+}
+
+func (c *MemoryStore) full() bool {
+	return (c.options.MaxEntries > 0 && c.tracker.Len() > c.options.MaxEntries) ||
+		(c.options.MaxBytes > 0 && c.tracker.bytes > c.options.MaxBytes)
 }
 
 // Delete remove key in memory store, do nothing if key doesn't exist
 func (c *MemoryStore) Delete(ctx context.Context, key string) error {
-	return c.Cache.Remove(key)
+	if c.bounded() {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.tracker.remove(key)
+	}
+
+	if err := c.Cache.Remove(key); err != nil && !errors.Is(err, ttlcache.ErrNotFound) {
+		return WrapError(opDelete, err)
+	}
+	return nil
 }
 
-// Get get key in memory store, if key doesn't exist, return ErrCacheMiss
+// Get get key in memory store, if key doesn't exist, return ErrCacheMiss.
+// value must be a pointer to a type the stored value is assignable to, otherwise return a *TypeMismatchError.
 func (c *MemoryStore) Get(ctx context.Context, key string, value interface{}) error {
+	val, err := c.load(key)
+	if err != nil {
+		return err
+	}
+
+	switch c.options.Isolation {
+	case IsolationSerialize:
+		payload, _ := val.([]byte)
+		if err := decodePayload(payload, value); err != nil {
+			return NewSerializationError(opGet, err)
+		}
+		return nil
+	case IsolationCopy:
+		if val, err = cloneValue(val); err != nil {
+			return NewSerializationError(opGet, err)
+		}
+	}
+
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return &TypeMismatchError{Key: key, Stored: reflect.TypeOf(val), Target: reflect.TypeOf(value)}
+	}
+	elem := v.Elem()
+	if val == nil {
+		elem.Set(reflect.Zero(elem.Type()))
+		return nil
+	}
+	stored := reflect.ValueOf(val)
+	if !stored.Type().AssignableTo(elem.Type()) {
+		return &TypeMismatchError{Key: key, Stored: stored.Type(), Target: elem.Type()}
+	}
+	elem.Set(stored)
+	return nil
+}
+
+// GetMulti gets the items of keys in memory store, the errors are the ones of Get in the order of keys
+func (c *MemoryStore) GetMulti(ctx context.Context, keys []string, values []interface{}) []error {
+	return getEach(ctx, c, keys, values)
+}
+
+// SetMulti puts the items in memory store, the remaining items are still put after a failure
+func (c *MemoryStore) SetMulti(ctx context.Context, items map[string]interface{}, expire time.Duration) error {
+	return setEach(ctx, c, items, expire)
+}
+
+// DeleteMulti removes the items of keys in memory store
+func (c *MemoryStore) DeleteMulti(ctx context.Context, keys []string) error {
+	return deleteEach(ctx, c, keys)
+}
+
+// DeletePrefix removes the items whose keys start with prefix in memory store
+func (c *MemoryStore) DeletePrefix(ctx context.Context, prefix string) error {
+	return deleteKeysWithPrefix(ctx, c, c.Cache.GetKeys(), prefix)
+}
+
+// load returns the stored value of key, and marks it used for the eviction
+func (c *MemoryStore) load(key string) (interface{}, error) {
 	val, err := c.Cache.Get(key)
 	if errors.Is(err, ttlcache.ErrNotFound) {
-		return ErrCacheMiss
+		return nil, ErrCacheMiss
+	}
+	if err != nil {
+		return nil, WrapError(opGet, err)
 	}
 
-	v := reflect.ValueOf(value)
-	v.Elem().Set(reflect.ValueOf(val))
+	if c.bounded() {
+		c.mu.Lock()
+		c.tracker.touch(key)
+		c.mu.Unlock()
+	}
+	return val, nil
+}
+
+// Stats returns the counters of a bounded store, the zero value if the store is unbounded
+func (c *MemoryStore) Stats() MemoryStoreStats {
+	if !c.bounded() {
+		return MemoryStoreStats{}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return MemoryStoreStats{
+		Entries:   c.tracker.Len(),
+		Bytes:     c.tracker.bytes,
+		Evictions: c.evictions,
+	}
+}
+
+// Close stops the background goroutine of the underlying ttlcache, calling it again does nothing
+func (c *MemoryStore) Close() error {
+	if err := c.Cache.Close(); err != nil && !errors.Is(err, ttlcache.ErrClosed) {
+		return err
+	}
 	return nil
 }
@@ -42,6 +42,8 @@ package persist
 
 import (
 	"context"
+	"errors"
+	"reflect"
 	"testing"
 	"time"
 
@@ -68,3 +70,218 @@ func TestMemoryStore(t *testing.T) {
 	memoryStore.Delete(ctx, "test")
 	assert.DeepEqual(t, ErrCacheMiss, memoryStore.Get(ctx, "test", &value))
 }
+
+func TestMemoryStoreMaxEntriesLRU(t *testing.T) {
+	ctx := context.Background()
+	var evicted []string
+	memoryStore := NewMemoryStore(time.Minute, WithMaxEntries(2), WithOnEvict(func(key string, value interface{}) {
+		evicted = append(evicted, key)
+	}))
+
+	assert.Nil(t, memoryStore.Set(ctx, "a", "1", time.Minute))
+	assert.Nil(t, memoryStore.Set(ctx, "b", "2", time.Minute))
+	value := ""
+	assert.Nil(t, memoryStore.Get(ctx, "a", &value))
+	assert.Nil(t, memoryStore.Set(ctx, "c", "3", time.Minute))
+
+	// b is the least recently used
+	assert.DeepEqual(t, []string{"b"}, evicted)
+	assert.DeepEqual(t, ErrCacheMiss, memoryStore.Get(ctx, "b", &value))
+	assert.Nil(t, memoryStore.Get(ctx, "a", &value))
+	assert.Nil(t, memoryStore.Get(ctx, "c", &value))
+	assert.DeepEqual(t, MemoryStoreStats{Entries: 2, Bytes: 2, Evictions: 1}, memoryStore.Stats())
+}
+
+func TestMemoryStoreMaxEntriesLFU(t *testing.T) {
+	ctx := context.Background()
+	memoryStore := NewMemoryStore(time.Minute, WithMaxEntries(2), WithEvictionPolicy(EvictionLFU))
+
+	value := ""
+	assert.Nil(t, memoryStore.Set(ctx, "a", "1", time.Minute))
+	assert.Nil(t, memoryStore.Set(ctx, "b", "2", time.Minute))
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, memoryStore.Get(ctx, "a", &value))
+	}
+	assert.Nil(t, memoryStore.Get(ctx, "b", &value))
+	assert.Nil(t, memoryStore.Set(ctx, "c", "3", time.Minute))
+
+	// b is used less frequently than a, although more recently
+	assert.DeepEqual(t, ErrCacheMiss, memoryStore.Get(ctx, "b", &value))
+	assert.Nil(t, memoryStore.Get(ctx, "a", &value))
+}
+
+type sizedValue int
+
+func (v sizedValue) Size() int {
+	return int(v)
+}
+
+func TestMemoryStoreMaxBytes(t *testing.T) {
+	ctx := context.Background()
+	memoryStore := NewMemoryStore(time.Minute, WithMaxBytes(100))
+
+	assert.Nil(t, memoryStore.Set(ctx, "a", sizedValue(40), time.Minute))
+	assert.Nil(t, memoryStore.Set(ctx, "b", sizedValue(40), time.Minute))
+	assert.Nil(t, memoryStore.Set(ctx, "c", sizedValue(40), time.Minute))
+	assert.DeepEqual(t, MemoryStoreStats{Entries: 2, Bytes: 80, Evictions: 1}, memoryStore.Stats())
+
+	// updating a key replaces its size
+	assert.Nil(t, memoryStore.Set(ctx, "c", sizedValue(10), time.Minute))
+	assert.DeepEqual(t, MemoryStoreStats{Entries: 2, Bytes: 50, Evictions: 1}, memoryStore.Stats())
+
+	assert.DeepEqual(t, ErrEntryTooLarge, memoryStore.Set(ctx, "d", sizedValue(101), time.Minute))
+
+	sized := NewMemoryStore(time.Minute, WithMaxBytes(100), WithSizer(func(value interface{}) int64 {
+		return 60
+	}))
+	assert.Nil(t, sized.Set(ctx, "a", 1, time.Minute))
+	assert.Nil(t, sized.Set(ctx, "b", 2, time.Minute))
+	assert.DeepEqual(t, MemoryStoreStats{Entries: 1, Bytes: 60, Evictions: 1}, sized.Stats())
+}
+
+func TestMemoryStoreBoundedExpiration(t *testing.T) {
+	ctx := context.Background()
+	memoryStore := NewMemoryStore(time.Minute, WithMaxEntries(10))
+
+	assert.Nil(t, memoryStore.Set(ctx, "a", "1", 100*time.Millisecond))
+	assert.Nil(t, memoryStore.Set(ctx, "b", "2", time.Minute))
+	assert.Nil(t, memoryStore.Delete(ctx, "b"))
+	time.Sleep(300 * time.Millisecond)
+
+	// the expired and deleted entries are no longer tracked
+	assert.DeepEqual(t, MemoryStoreStats{}, memoryStore.Stats())
+}
+
+func TestMemoryStoreTypeMismatch(t *testing.T) {
+	ctx := context.Background()
+	memoryStore := NewMemoryStore(time.Minute)
+	assert.Nil(t, memoryStore.Set(ctx, "test", "value", time.Minute))
+
+	var number int
+	err := memoryStore.Get(ctx, "test", &number)
+	assert.True(t, errors.Is(err, ErrTypeMismatch))
+	var mismatch *TypeMismatchError
+	assert.True(t, errors.As(err, &mismatch))
+	assert.DeepEqual(t, reflect.TypeOf(""), mismatch.Stored)
+	assert.DeepEqual(t, reflect.TypeOf(0), mismatch.Target)
+
+	assert.True(t, errors.Is(memoryStore.Get(ctx, "test", "not a pointer"), ErrTypeMismatch))
+	assert.True(t, errors.Is(memoryStore.Get(ctx, "test", (*string)(nil)), ErrTypeMismatch))
+
+	// assignable to an interface
+	var iface interface{}
+	assert.Nil(t, memoryStore.Get(ctx, "test", &iface))
+	assert.DeepEqual(t, "value", iface)
+
+	// the stored nil is read as the zero value
+	assert.Nil(t, memoryStore.Set(ctx, "nil", nil, time.Minute))
+	value := "not zero"
+	assert.Nil(t, memoryStore.Get(ctx, "nil", &value))
+	assert.DeepEqual(t, "", value)
+
+	// the errors other than not found are returned
+	assert.Nil(t, memoryStore.Cache.Close())
+	err = memoryStore.Get(ctx, "test", &value)
+	assert.NotNil(t, err)
+	assert.False(t, errors.Is(err, ErrCacheMiss))
+	assert.NotNil(t, memoryStore.Delete(ctx, "missing"))
+}
+
+func TestTypedMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewTypedMemoryStore[*testStruct](time.Minute, WithMaxEntries(1))
+
+	value, err := store.Get(ctx, "test")
+	assert.DeepEqual(t, ErrCacheMiss, err)
+	assert.Nil(t, value)
+
+	assert.Nil(t, store.Set(ctx, "test", &testStruct{A: 1}, time.Minute))
+	value, err = store.Get(ctx, "test")
+	assert.Nil(t, err)
+	assert.DeepEqual(t, 1, value.A)
+
+	assert.Nil(t, store.Set(ctx, "test2", &testStruct{A: 2}, time.Minute))
+	_, err = store.Get(ctx, "test")
+	assert.DeepEqual(t, ErrCacheMiss, err)
+	assert.DeepEqual(t, uint64(1), store.MemoryStore().Stats().Evictions)
+
+	assert.Nil(t, store.Delete(ctx, "test2"))
+	assert.Nil(t, store.Delete(ctx, "test2"))
+	_, err = store.Get(ctx, "test2")
+	assert.DeepEqual(t, ErrCacheMiss, err)
+
+	// a value of another type set through the underlying store is a mismatch, not a panic
+	assert.Nil(t, store.MemoryStore().Set(ctx, "other", "string", time.Minute))
+	value, err = store.Get(ctx, "other")
+	assert.True(t, errors.Is(err, ErrTypeMismatch))
+	assert.Nil(t, value)
+	var mismatch *TypeMismatchError
+	assert.True(t, errors.As(err, &mismatch))
+	assert.DeepEqual(t, reflect.TypeOf(""), mismatch.Stored)
+	assert.DeepEqual(t, reflect.TypeOf(&testStruct{}), mismatch.Target)
+}
+
+type mutableValue struct {
+	Tags []string
+}
+
+type clonedValue struct {
+	Tags   []string
+	Cloned bool
+}
+
+func (v *clonedValue) Clone() *clonedValue {
+	return &clonedValue{Tags: append([]string{}, v.Tags...), Cloned: true}
+}
+
+func TestMemoryStoreIsolation(t *testing.T) {
+	ctx := context.Background()
+
+	shared := NewMemoryStore(time.Minute)
+	assert.Nil(t, shared.Set(ctx, "test", &mutableValue{Tags: []string{"a"}}, time.Minute))
+	var value *mutableValue
+	assert.Nil(t, shared.Get(ctx, "test", &value))
+	value.Tags[0] = "mutated"
+	assert.Nil(t, shared.Get(ctx, "test", &value))
+	assert.DeepEqual(t, "mutated", value.Tags[0])
+
+	for _, mode := range []IsolationMode{IsolationCopy, IsolationSerialize} {
+		store := NewMemoryStore(time.Minute, WithIsolation(mode))
+		assert.Nil(t, store.Set(ctx, "test", &mutableValue{Tags: []string{"a"}}, time.Minute))
+
+		var value *mutableValue
+		assert.Nil(t, store.Get(ctx, "test", &value))
+		value.Tags[0] = "mutated"
+		assert.Nil(t, store.Get(ctx, "test", &value))
+		assert.DeepEqual(t, "a", value.Tags[0])
+	}
+
+	// copy mode uses the Clone method if any
+	store := NewMemoryStore(time.Minute, WithIsolation(IsolationCopy))
+	assert.Nil(t, store.Set(ctx, "test", &clonedValue{Tags: []string{"a"}}, time.Minute))
+	var cloned *clonedValue
+	assert.Nil(t, store.Get(ctx, "test", &cloned))
+	assert.True(t, cloned.Cloned)
+
+	// the serialized values are bounded by the size of the original value
+	serialized := NewMemoryStore(time.Minute, WithIsolation(IsolationSerialize), WithMaxBytes(10))
+	assert.Nil(t, serialized.Set(ctx, "test", "value", time.Minute))
+	assert.DeepEqual(t, int64(5), serialized.Stats().Bytes)
+	typed := NewTypedMemoryStore[*mutableValue](time.Minute, WithIsolation(IsolationSerialize))
+	assert.Nil(t, typed.Set(ctx, "test", &mutableValue{Tags: []string{"a"}}, time.Minute))
+	value, err := typed.Get(ctx, "test")
+	assert.Nil(t, err)
+	assert.DeepEqual(t, []string{"a"}, value.Tags)
+}
+
+func TestMemoryStoreClose(t *testing.T) {
+	memoryStore := NewMemoryStore(time.Minute)
+	var _ Closer = memoryStore
+	assert.Nil(t, CloseStore(memoryStore))
+	assert.Nil(t, memoryStore.Close())
+	assert.NotNil(t, memoryStore.Set(context.Background(), "test", "value", time.Minute))
+
+	typed := NewTypedMemoryStore[string](time.Minute)
+	assert.Nil(t, typed.Close())
+	assert.Nil(t, CloseStore(NewEncryptedStore(typed.MemoryStore(), newTestKeyring(t, 1))))
+}
@@ -0,0 +1,79 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package persist
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// ErrPrefixDeleteUnsupported represent the store can not remove the items by the prefix of their keys
+var ErrPrefixDeleteUnsupported = errors.New("persist prefix delete unsupported")
+
+// PrefixDeleter is implemented by the stores removing all the items whose keys start with a prefix
+type PrefixDeleter interface {
+	// DeletePrefix removes the items whose keys start with prefix. Does nothing if there is none.
+	DeletePrefix(ctx context.Context, prefix string) error
+}
+
+// DeletePrefix removes the items whose keys start with prefix from store,
+// return ErrPrefixDeleteUnsupported for the stores not implementing PrefixDeleter
+func DeletePrefix(ctx context.Context, store CacheStore, prefix string) error {
+	if deleter, ok := store.(PrefixDeleter); ok {
+		return deleter.DeletePrefix(ctx, prefix)
+	}
+	return ErrPrefixDeleteUnsupported
+}
+
+// deleteKeysWithPrefix removes the keys starting with prefix with one Delete per key, and returns the first error
+func deleteKeysWithPrefix(ctx context.Context, store CacheStore, keys []string, prefix string) error {
+	var firstErr error
+	for _, key := range keys {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if err := store.Delete(ctx, key); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,146 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package persist
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/go-redis/redis/v8"
+)
+
+func testPrefixDeleter(t *testing.T, store CacheStore) {
+	ctx := context.Background()
+
+	keys := []string{"pre*fix/a", "pre*fix/b?x=y", "pre-fix/c", "pre*fi"}
+	for _, key := range keys {
+		assert.Nil(t, store.Set(ctx, key, key, time.Minute))
+	}
+	defer DeleteMulti(ctx, store, keys)
+
+	// the special characters of the patterns are matched literally
+	assert.Nil(t, DeletePrefix(ctx, store, "pre*fix/"))
+	value := ""
+	assert.DeepEqual(t, ErrCacheMiss, store.Get(ctx, "pre*fix/a", &value))
+	assert.DeepEqual(t, ErrCacheMiss, store.Get(ctx, "pre*fix/b?x=y", &value))
+	assert.Nil(t, store.Get(ctx, "pre-fix/c", &value))
+	assert.DeepEqual(t, "pre-fix/c", value)
+	assert.Nil(t, store.Get(ctx, "pre*fi", &value))
+	assert.DeepEqual(t, "pre*fi", value)
+
+	assert.Nil(t, DeletePrefix(ctx, store, "missing/"))
+}
+
+func TestPrefixMemoryStore(t *testing.T) {
+	store := NewMemoryStore(time.Minute, WithMaxEntries(10))
+	defer store.Close()
+
+	var _ PrefixDeleter = store
+	testPrefixDeleter(t, store)
+	assert.DeepEqual(t, 0, store.Stats().Entries)
+}
+
+func TestPrefixShardedStore(t *testing.T) {
+	store := NewShardedStore(time.Minute, WithShards(4))
+	defer store.Close()
+
+	testPrefixDeleter(t, store)
+	assert.DeepEqual(t, 0, store.Len())
+}
+
+func TestPrefixRedisStore(t *testing.T) {
+	store := NewRedisStore(redis.NewClient(&redis.Options{
+		Addr: "127.0.0.1:6379",
+	}))
+	defer store.Close()
+
+	testPrefixDeleter(t, store)
+}
+
+func TestPrefixRedisStoreClusterClient(t *testing.T) {
+	store := NewRedisStore(redis.NewClusterClient(&redis.ClusterOptions{
+		Addrs: []string{"127.0.0.1:6379"},
+	}))
+	defer store.Close()
+
+	testPrefixDeleter(t, store)
+}
+
+func TestPrefixWrappedStores(t *testing.T) {
+	memoryStore := NewMemoryStore(time.Minute)
+	defer memoryStore.Close()
+
+	testPrefixDeleter(t, NewCircuitBreakerStore(memoryStore))
+	testPrefixDeleter(t, NewEncryptedStore(memoryStore, newTestKeyring(t, 1)))
+}
+
+func TestPrefixUnsupported(t *testing.T) {
+	ctx := context.Background()
+	memoryStore := NewMemoryStore(time.Minute)
+	defer memoryStore.Close()
+	store := unbatchedStore{CacheStore: memoryStore}
+
+	assert.DeepEqual(t, ErrPrefixDeleteUnsupported, DeletePrefix(ctx, store, "prefix"))
+	assert.DeepEqual(t, ErrPrefixDeleteUnsupported, DeletePrefix(ctx, NewCircuitBreakerStore(store), "prefix"))
+	// the storage keys hashed with HMAC do not keep the prefixes
+	encryptedStore := NewEncryptedStore(memoryStore, newTestKeyring(t, 1), WithKeyHMAC([]byte("secret")))
+	assert.DeepEqual(t, ErrPrefixDeleteUnsupported, DeletePrefix(ctx, encryptedStore, "prefix"))
+}
+
+func TestPrefixTieredStore(t *testing.T) {
+	ctx := context.Background()
+	nodeA := newTestTieredStore("node-a")
+	defer nodeA.Close()
+	nodeB := newTestTieredStore("node-b")
+	defer nodeB.Close()
+
+	testPrefixDeleter(t, nodeA)
+
+	// the prefix is invalidated in the L1 of the other instances
+	assert.Nil(t, nodeA.Set(ctx, "tiered-prefix/a", "a", time.Minute))
+	value := ""
+	assert.Nil(t, nodeB.Get(ctx, "tiered-prefix/a", &value))
+	assert.Nil(t, nodeA.DeletePrefix(ctx, "tiered-prefix/"))
+	waitL1Miss(t, nodeB, "tiered-prefix/a")
+	assert.DeepEqual(t, ErrCacheMiss, nodeB.Get(ctx, "tiered-prefix/a", &value))
+}
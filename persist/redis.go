@@ -43,36 +43,152 @@ package persist
 import (
 	"context"
 	"errors"
+	"hash/fnv"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-redis/redis/v8"
 )
 
+// scanCount the number of keys hinted to SCAN per call
+const scanCount = 1000
+
+// globEscaper escapes the special characters of the redis glob-style patterns
+var globEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+
 // RedisStore store http response in redis
 type RedisStore struct {
-	RedisClient *redis.Client
+	RedisClient redis.UniversalClient
+
+	options RedisStoreOptions
+}
+
+// RedisStoreOptions contains the options of RedisStore
+type RedisStoreOptions struct {
+	// Codec marshals the values written to redis, nil picks the codec by the value
+	Codec Codec
+	// Compressor compresses the payloads reaching CompressionThreshold, nil disables the compression
+	Compressor Compressor
+	// CompressionThreshold the minimum size in bytes of the payloads to compress
+	CompressionThreshold int
+	// DeleteOnMismatch deletes the entries failing the schema or checksum verification
+	DeleteOnMismatch bool
+}
+
+// RedisStoreOption represents the optional function of RedisStore.
+type RedisStoreOption struct {
+	F func(o *RedisStoreOptions)
+}
+
+// WithCodec set up the codec of the values written to redis, default is BinaryCodec for []byte and the values
+// implementing encoding.BinaryMarshaler, and GobCodec for the others.
+// The entries written with any registered codec are still readable, which allows to migrate between codecs.
+func WithCodec(codec Codec) RedisStoreOption {
+	return RedisStoreOption{F: func(o *RedisStoreOptions) {
+		o.Codec = codec
+	}}
+}
+
+// WithCompression compresses the payloads of at least threshold bytes with compressor, as the small ones barely shrink.
+// The uncompressed entries, and the ones compressed with any registered compressor, are still readable.
+// The entries with the identifier of compressor are decompressed by it, e.g. within its MaxSize.
+func WithCompression(compressor Compressor, threshold int) RedisStoreOption {
+	return RedisStoreOption{F: func(o *RedisStoreOptions) {
+		o.Compressor = compressor
+		o.CompressionThreshold = threshold
+	}}
 }
 
-// NewRedisStore create a redis memory store with redis client
-func NewRedisStore(redisClient *redis.Client) *RedisStore {
+// WithDeleteOnMismatch deletes the entries written for another type, another schema version or corrupted,
+// instead of leaving them until they expire. They are misses either way.
+func WithDeleteOnMismatch(enable bool) RedisStoreOption {
+	return RedisStoreOption{F: func(o *RedisStoreOptions) {
+		o.DeleteOnMismatch = enable
+	}}
+}
+
+// NewRedisStore create a redis memory store with redis client, which can be a *redis.Client,
+// a *redis.ClusterClient, a *redis.Ring or a failover client of sentinel
+func NewRedisStore(redisClient redis.UniversalClient, opts ...RedisStoreOption) *RedisStore {
+	options := RedisStoreOptions{}
+	for _, opt := range opts {
+		opt.F(&options)
+	}
+
 	return &RedisStore{
 		RedisClient: redisClient,
+		options:     options,
 	}
 }
 
-// Set put key value pair to redis, and expire after expireDuration
+// fencedSetScript sets KEYS[1] unless the fencing token KEYS[2] is newer than the writer's token ARGV[2]
+var fencedSetScript = redis.NewScript(`
+local fence = tonumber(redis.call("GET", KEYS[2]))
+if fence and fence > tonumber(ARGV[2]) then
+	return 0
+end
+if tonumber(ARGV[3]) > 0 then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[3])
+else
+	redis.call("SET", KEYS[1], ARGV[1])
+end
+return 1
+`)
+
+// Set put key value pair to redis, and expire after expireDuration.
+// If ctx carries a lock token, see WithLockToken, the write is rejected with ErrStaleLockToken
+// when a newer lock was obtained on key with RedisLocker, or on the key mapped to key by a wrapping store.
 func (store *RedisStore) Set(ctx context.Context, key string, value interface{}, expire time.Duration) error {
-	payload, err := Serialize(value)
+	payload, err := store.encode(value)
 	if err != nil {
-		return err
+		return NewSerializationError(opSet, err)
+	}
+
+	if token, ok := LockToken(ctx); ok {
+		return store.fencedSet(ctx, key, payload, expire, token)
+	}
+	return WrapError(opSet, store.RedisClient.Set(ctx, key, payload, expire).Err())
+}
+
+// fencedSet sets the payload unless the fencing token of key is newer than token
+func (store *RedisStore) fencedSet(ctx context.Context, key string, payload []byte, expire time.Duration, token int64) error {
+	var expireMillis int64
+	if expire > 0 {
+		expireMillis = expire.Milliseconds()
+		if expireMillis == 0 {
+			expireMillis = 1
+		}
 	}
 
-	return store.RedisClient.Set(ctx, key, payload, expire).Err()
+	// the fencing token is the one of the locked key, which may be mapped to key by a wrapping store
+	lockedKey, mapped := lockedKeyOf(ctx, key)
+	fenceKey := fenceKeyOf(lockedKey)
+	if _, sameSlot := hashTag(key); (sameSlot && !mapped) || store.singleNode() {
+		set, err := fencedSetScript.Run(ctx, store.RedisClient, []string{key, fenceKey}, payload, token, expireMillis).Int64()
+		if err != nil {
+			return WrapError(opSet, err)
+		}
+		if set == 0 {
+			return ErrStaleLockToken
+		}
+		return nil
+	}
+
+	// the fencing token key is in another cluster slot, check it before the write
+	fence, err := store.RedisClient.Get(ctx, fenceKey).Int64()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return WrapError(opSet, err)
+	}
+	if fence > token {
+		return ErrStaleLockToken
+	}
+	return WrapError(opSet, store.RedisClient.Set(ctx, key, payload, expire).Err())
 }
 
 // Delete remove key in redis, do nothing if key doesn't exist
 func (store *RedisStore) Delete(ctx context.Context, key string) error {
-	return store.RedisClient.Del(ctx, key).Err()
+	return WrapError(opDelete, store.RedisClient.Del(ctx, key).Err())
 }
 
 // Get retrieves an item from redis, if key doesn't exist, return ErrCacheMiss
@@ -84,7 +200,256 @@ func (store *RedisStore) Get(ctx context.Context, key string, value interface{})
 	}
 
 	if err != nil {
+		return WrapError(opGet, err)
+	}
+
+	return store.decode(ctx, key, payload, value)
+}
+
+// getWithTTL retrieves an item and its remaining ttl in one round trip, the ttl is negative if key does not expire
+// and 0 if key expired right after it was read
+func (store *RedisStore) getWithTTL(ctx context.Context, key string, value interface{}) (time.Duration, error) {
+	var get *redis.StringCmd
+	var pttl *redis.DurationCmd
+	_, _ = store.RedisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, key)
+		pttl = pipe.PTTL(ctx, key)
+		return nil
+	})
+
+	payload, err := get.Bytes()
+	if errors.Is(err, redis.Nil) {
+		return 0, ErrCacheMiss
+	}
+	if err != nil {
+		return 0, WrapError(opGet, err)
+	}
+	if err := store.decode(ctx, key, payload, value); err != nil {
+		return 0, err
+	}
+
+	ttl, err := pttl.Result()
+	if err != nil {
+		return 0, WrapError(opGet, err)
+	}
+	switch ttl {
+	case -1:
+		// key does not expire
+		return -1, nil
+	case -2:
+		// key does not exist anymore
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+// GetMulti retrieves the items of keys with one MGET, or with a pipeline of GET for the clients
+// whose keys may be in several slots or shards, e.g. *redis.ClusterClient and *redis.Ring
+func (store *RedisStore) GetMulti(ctx context.Context, keys []string, values []interface{}) []error {
+	errs := make([]error, len(keys))
+	if len(keys) == 0 {
+		return errs
+	}
+
+	payloads := make([][]byte, len(keys))
+	if store.singleNode() {
+		results, err := store.RedisClient.MGet(ctx, keys...).Result()
+		if err != nil {
+			return fillErrors(errs, WrapError(opGet, err))
+		}
+		for i, result := range results {
+			if payload, ok := result.(string); ok {
+				payloads[i] = []byte(payload)
+			} else {
+				errs[i] = ErrCacheMiss
+			}
+		}
+	} else {
+		cmds := make([]*redis.StringCmd, len(keys))
+		_, _ = store.RedisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+			for i, key := range keys {
+				cmds[i] = pipe.Get(ctx, key)
+			}
+			return nil
+		})
+		for i, cmd := range cmds {
+			payload, err := cmd.Bytes()
+			switch {
+			case errors.Is(err, redis.Nil):
+				errs[i] = ErrCacheMiss
+			case err != nil:
+				errs[i] = WrapError(opGet, err)
+			default:
+				payloads[i] = payload
+			}
+		}
+	}
+
+	for i, key := range keys {
+		if errs[i] == nil {
+			errs[i] = store.decode(ctx, key, payloads[i], values[i])
+		}
+	}
+	return errs
+}
+
+// SetMulti sets the items with a pipeline of SET, as MSET can not set their expiration.
+// The remaining items are still set after a serialization failure.
+func (store *RedisStore) SetMulti(ctx context.Context, items map[string]interface{}, expire time.Duration) error {
+	var firstErr error
+	payloads := make(map[string][]byte, len(items))
+	for key, value := range items {
+		payload, err := store.encode(value)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = NewSerializationError(opSet, err)
+			}
+			continue
+		}
+		payloads[key] = payload
+	}
+	if len(payloads) == 0 {
+		return firstErr
+	}
+
+	_, err := store.RedisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for key, payload := range payloads {
+			pipe.Set(ctx, key, payload, expire)
+		}
+		return nil
+	})
+	if firstErr == nil {
+		firstErr = WrapError(opSet, err)
+	}
+	return firstErr
+}
+
+// DeleteMulti removes the keys with one DEL, or with a pipeline of DEL for the clients
+// whose keys may be in several slots or shards
+func (store *RedisStore) DeleteMulti(ctx context.Context, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	if store.singleNode() {
+		return WrapError(opDelete, store.RedisClient.Del(ctx, keys...).Err())
+	}
+
+	_, err := store.RedisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, key := range keys {
+			pipe.Del(ctx, key)
+		}
+		return nil
+	})
+	return WrapError(opDelete, err)
+}
+
+// DeletePrefix removes the keys starting with prefix, iterating the keys of every master or shard with SCAN.
+// The keys are removed in batches as they are found, the ones written meanwhile may be left.
+func (store *RedisStore) DeletePrefix(ctx context.Context, prefix string) error {
+	pattern := globEscaper.Replace(prefix) + "*"
+	deleteNode := func(ctx context.Context, node *redis.Client) error {
+		return deleteMatching(ctx, node, pattern)
+	}
+
+	var err error
+	switch client := store.RedisClient.(type) {
+	case *redis.ClusterClient:
+		err = client.ForEachMaster(ctx, deleteNode)
+	case *redis.Ring:
+		err = client.ForEachShard(ctx, deleteNode)
+	default:
+		err = deleteMatching(ctx, store.RedisClient, pattern)
+	}
+	return WrapError(opDelete, err)
+}
+
+// deleteMatching removes the keys of one node matching pattern, with a pipeline of DEL per SCAN batch,
+// as the keys of a cluster node may be in several slots
+func deleteMatching(ctx context.Context, client redis.Cmdable, pattern string) error {
+	var cursor uint64
+	for {
+		keys, next, err := client.Scan(ctx, cursor, pattern, scanCount).Result()
+		if err != nil {
+			return err
+		}
+		if len(keys) > 0 {
+			if _, err := client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+				for _, key := range keys {
+					pipe.Del(ctx, key)
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+		if next == 0 {
+			return nil
+		}
+		cursor = next
+	}
+}
+
+// singleNode reports whether all the keys are served by one node, which accepts the multi-key commands
+func (store *RedisStore) singleNode() bool {
+	_, ok := store.RedisClient.(*redis.Client)
+	return ok
+}
+
+// encode marshals value into the payload written to redis
+func (store *RedisStore) encode(value interface{}) ([]byte, error) {
+	payload, err := encodePayload(codecFor(store.options.Codec, value), value)
+	if err != nil {
+		return nil, err
+	}
+	return compressPayload(store.options.Compressor, store.options.CompressionThreshold, sealEnvelope(value, payload))
+}
+
+// decode unmarshals the payload read from key into value
+func (store *RedisStore) decode(ctx context.Context, key string, payload []byte, value interface{}) error {
+	payload, err := decompressPayload(store.options.Compressor, payload)
+	if err != nil {
+		return NewSerializationError(opGet, err)
+	}
+	payload, err = openEnvelope(payload, value)
+	if err != nil {
+		if store.options.DeleteOnMismatch {
+			store.RedisClient.Del(ctx, key)
+		}
 		return err
 	}
-	return Deserialize(payload, value)
+	if err := decodePayload(payload, value); err != nil {
+		return NewSerializationError(opGet, err)
+	}
+	return nil
+}
+
+// Close closes the redis client, the other users of the client can not use it anymore
+func (store *RedisStore) Close() error {
+	return store.RedisClient.Close()
+}
+
+// HashTag returns a redis cluster hash tag for key, so that the keys built from it, e.g. "lock:" + HashTag(key)
+// and "lock:" + HashTag(key) + ":fence", are in the same slot as key and can be used in one multi-key command.
+// The keys hashed as a whole which contain a closing brace can not be tagged as is,
+// they are replaced by their hash and their tag is in another slot.
+func HashTag(key string) string {
+	tag, _ := hashTag(key)
+	return tag
+}
+
+// hashTag returns the hash tag of key, and whether it is in the same slot as key
+func hashTag(key string) (string, bool) {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			// redis hashes only the tag of key, keep it and append key to tell apart the keys sharing it
+			return key[start:start+end+2] + key, true
+		}
+	}
+	if key != "" && !strings.Contains(key, "}") {
+		return "{" + key + "}", true
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return "{" + strconv.FormatUint(h.Sum64(), 16) + "}", false
 }
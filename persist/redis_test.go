@@ -41,7 +41,10 @@
 package persist
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"strings"
 	"testing"
 	"time"
 
@@ -72,3 +75,98 @@ func TestRedisStore(t *testing.T) {
 	redisStore.Delete(ctx, "test")
 	assert.DeepEqual(t, ErrCacheMiss, redisStore.Get(ctx, "test", &value))
 }
+
+func TestRedisStoreCodecMigration(t *testing.T) {
+	client := redis.NewClient(&redis.Options{
+		Addr: "127.0.0.1:6379",
+	})
+	ctx := context.Background()
+
+	// the entries written before the migration are readable with the new codec
+	legacy, err := Serialize("legacy")
+	assert.Nil(t, err)
+	assert.Nil(t, client.Set(ctx, "test-legacy", legacy, time.Minute).Err())
+	defer client.Del(ctx, "test-legacy")
+
+	gobStore := NewRedisStore(client)
+	jsonStore := NewRedisStore(client, WithCodec(JSONCodec{}))
+	value := ""
+	assert.Nil(t, jsonStore.Get(ctx, "test-legacy", &value))
+	assert.DeepEqual(t, "legacy", value)
+
+	assert.Nil(t, jsonStore.Set(ctx, "test-codec", "json", time.Minute))
+	defer jsonStore.Delete(ctx, "test-codec")
+	payload, err := client.Get(ctx, "test-codec").Bytes()
+	assert.Nil(t, err)
+	assert.DeepEqual(t, envelopeMagic, payload[0])
+	assert.True(t, bytes.HasSuffix(payload, append([]byte{payloadMagic, CodecIDJSON}, `"json"`...)))
+
+	assert.Nil(t, gobStore.Get(ctx, "test-codec", &value))
+	assert.DeepEqual(t, "json", value)
+}
+
+func TestRedisStoreClose(t *testing.T) {
+	redisStore := NewRedisStore(redis.NewClient(&redis.Options{
+		Addr: "127.0.0.1:6379",
+	}))
+	assert.Nil(t, CloseStore(redisStore))
+
+	value := ""
+	err := redisStore.Get(context.Background(), "test", &value)
+	assert.NotNil(t, err)
+	assert.False(t, errors.Is(err, ErrCacheMiss))
+}
+
+func TestHashTag(t *testing.T) {
+	assert.DeepEqual(t, "{/cache?uid=1}", HashTag("/cache?uid=1"))
+
+	// the keys with braces are hashed, otherwise "lock:{}a}" would not be tagged
+	tag := HashTag("}a")
+	assert.DeepEqual(t, tag, HashTag("}a"))
+	assert.NotEqual(t, tag, HashTag("{a"))
+	assert.DeepEqual(t, byte('{'), tag[0])
+	assert.DeepEqual(t, 1, strings.Count(tag, "}"))
+
+	// the hash tag of key is kept, so that the lock keys are in the same slot as key
+	assert.DeepEqual(t, "{user1}{user1}:profile", HashTag("{user1}:profile"))
+	assert.DeepEqual(t, "{a{b}", HashTag("a{b"))
+	_, sameSlot := hashTag("{}a")
+	assert.False(t, sameSlot)
+}
+
+func TestRedisStoreClusterClient(t *testing.T) {
+	client := redis.NewClusterClient(&redis.ClusterOptions{
+		Addrs: []string{"127.0.0.1:6379"},
+	})
+	defer client.Close()
+	ctx := context.Background()
+
+	store := NewRedisStore(client)
+	assert.Nil(t, store.Set(ctx, "test-cluster", "value", time.Minute))
+	value := ""
+	assert.Nil(t, store.Get(ctx, "test-cluster", &value))
+	assert.DeepEqual(t, "value", value)
+	assert.Nil(t, store.Delete(ctx, "test-cluster"))
+	assert.DeepEqual(t, ErrCacheMiss, store.Get(ctx, "test-cluster", &value))
+
+	// the lock and its fencing token are set in one script
+	locker := NewRedisLocker(client)
+	lock, err := locker.Obtain(ctx, "}cluster", time.Second)
+	assert.Nil(t, err)
+	assert.Nil(t, lock.Release(ctx))
+}
+
+func TestRedisStoreUniversalClient(t *testing.T) {
+	client := redis.NewUniversalClient(&redis.UniversalOptions{
+		Addrs: []string{"127.0.0.1:6379"},
+	})
+	ctx := context.Background()
+
+	store := NewRedisStore(client)
+	defer store.Close()
+	assert.Nil(t, store.Set(ctx, "test-universal", "value", time.Minute))
+	value := ""
+	assert.Nil(t, store.Get(ctx, "test-universal", &value))
+	assert.DeepEqual(t, "value", value)
+	assert.Nil(t, store.Delete(ctx, "test-universal"))
+}
@@ -0,0 +1,336 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package persist
+
+import (
+	"container/heap"
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultShardCount      = 256
+	defaultCleanupInterval = time.Second
+)
+
+// ShardedStoreOptions contains the options of ShardedStore
+type ShardedStoreOptions struct {
+	// Shards the number of shards, rounded up to a power of two
+	Shards int
+	// CleanupInterval the interval to remove the expired entries, they are misses as soon as they expire anyway
+	CleanupInterval time.Duration
+	// Codec encodes the values stored as byte slices, nil picks the codec by the value
+	Codec Codec
+}
+
+// ShardedStoreOption represents the optional function of ShardedStore.
+type ShardedStoreOption struct {
+	F func(o *ShardedStoreOptions)
+}
+
+// WithShards set up the number of shards, rounded up to a power of two, default is 256
+func WithShards(n int) ShardedStoreOption {
+	return ShardedStoreOption{F: func(o *ShardedStoreOptions) {
+		o.Shards = n
+	}}
+}
+
+// WithCleanupInterval set up the interval to remove the expired entries, default is 1s which is also used for a non-positive interval
+func WithCleanupInterval(interval time.Duration) ShardedStoreOption {
+	return ShardedStoreOption{F: func(o *ShardedStoreOptions) {
+		o.CleanupInterval = interval
+	}}
+}
+
+// WithShardedCodec set up the codec of the values, default is BinaryCodec for []byte, string and the values
+// implementing encoding.BinaryMarshaler, and GobCodec for the others
+func WithShardedCodec(codec Codec) ShardedStoreOption {
+	return ShardedStoreOption{F: func(o *ShardedStoreOptions) {
+		o.Codec = codec
+	}}
+}
+
+// ShardedStore local memory cache store for high concurrency. The keys are spread over shards by hash,
+// each with its own lock and expiration heap, and the values are stored encoded as byte slices,
+// which holds fewer pointers for the GC to scan and isolates the readers from each other.
+type ShardedStore struct {
+	defaultExpiration time.Duration
+	options           ShardedStoreOptions
+	shards            []*shard
+	mask              uint64
+
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// NewShardedStore allocate a sharded local memory store with default expiration
+func NewShardedStore(defaultExpiration time.Duration, opts ...ShardedStoreOption) *ShardedStore {
+	options := ShardedStoreOptions{
+		Shards:          defaultShardCount,
+		CleanupInterval: defaultCleanupInterval,
+	}
+	for _, opt := range opts {
+		opt.F(&options)
+	}
+	if options.CleanupInterval <= 0 {
+		options.CleanupInterval = defaultCleanupInterval
+	}
+
+	n := 1
+	for n < options.Shards {
+		n <<= 1
+	}
+
+	store := &ShardedStore{
+		defaultExpiration: defaultExpiration,
+		options:           options,
+		shards:            make([]*shard, n),
+		mask:              uint64(n - 1),
+		done:              make(chan struct{}),
+	}
+	for i := range store.shards {
+		store.shards[i] = &shard{items: make(map[string]*shardItem)}
+	}
+
+	store.wg.Add(1)
+	go store.cleanup()
+
+	return store
+}
+
+// shardOf returns the shard of key by its fnv-1a hash, inlined to avoid allocating a hash.Hash
+func (s *ShardedStore) shardOf(key string) *shard {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(key); i++ {
+		h ^= uint64(key[i])
+		h *= 1099511628211
+	}
+	return s.shards[h&s.mask]
+}
+
+// codecFor returns the codec of value, the strings are stored with BinaryCodec as the payloads never leave the process
+func (s *ShardedStore) codecFor(value interface{}) Codec {
+	if _, ok := value.(string); ok && s.options.Codec == nil {
+		return BinaryCodec{}
+	}
+	return codecFor(s.options.Codec, value)
+}
+
+// Set put key value pair to the store, and expire after expire, zero means the default expiration
+func (s *ShardedStore) Set(ctx context.Context, key string, value interface{}, expire time.Duration) error {
+	payload, err := encodePayload(s.codecFor(value), value)
+	if err != nil {
+		return NewSerializationError(opSet, err)
+	}
+	if expire <= 0 {
+		expire = s.defaultExpiration
+	}
+
+	s.shardOf(key).set(key, payload, time.Now().Add(expire).UnixNano())
+	return nil
+}
+
+// Delete remove key in the store, do nothing if key doesn't exist
+func (s *ShardedStore) Delete(ctx context.Context, key string) error {
+	s.shardOf(key).delete(key)
+	return nil
+}
+
+// DeletePrefix removes the items whose keys start with prefix, locking one shard at a time
+func (s *ShardedStore) DeletePrefix(ctx context.Context, prefix string) error {
+	for _, sh := range s.shards {
+		sh.deletePrefix(prefix)
+	}
+	return nil
+}
+
+// Get retrieves an item from the store, if key doesn't exist or has expired, return ErrCacheMiss
+func (s *ShardedStore) Get(ctx context.Context, key string, value interface{}) error {
+	payload, ok := s.shardOf(key).get(key, time.Now().UnixNano())
+	if !ok {
+		return ErrCacheMiss
+	}
+
+	if err := decodePayload(payload, value); err != nil {
+		return NewSerializationError(opGet, err)
+	}
+	return nil
+}
+
+// Len returns the number of entries, including the expired ones not removed yet
+func (s *ShardedStore) Len() int {
+	n := 0
+	for _, sh := range s.shards {
+		sh.mu.RLock()
+		n += len(sh.items)
+		sh.mu.RUnlock()
+	}
+	return n
+}
+
+// Close stops removing the expired entries in background
+func (s *ShardedStore) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+	s.wg.Wait()
+	return nil
+}
+
+func (s *ShardedStore) cleanup() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(s.options.CleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case now := <-ticker.C:
+			for _, sh := range s.shards {
+				sh.removeExpired(now.UnixNano())
+			}
+		}
+	}
+}
+
+type shardItem struct {
+	key      string
+	payload  []byte
+	expireAt int64
+	index    int
+}
+
+// shard holds the items of a part of the keys, with a min heap of their expiration
+type shard struct {
+	mu    sync.RWMutex
+	items map[string]*shardItem
+	heap  expiryHeap
+}
+
+func (sh *shard) get(key string, now int64) ([]byte, bool) {
+	sh.mu.RLock()
+	defer sh.mu.RUnlock()
+	item, ok := sh.items[key]
+	if !ok || item.expireAt <= now {
+		return nil, false
+	}
+	return item.payload, true
+}
+
+func (sh *shard) set(key string, payload []byte, expireAt int64) {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if item, ok := sh.items[key]; ok {
+		item.payload = payload
+		item.expireAt = expireAt
+		heap.Fix(&sh.heap, item.index)
+		return
+	}
+
+	item := &shardItem{key: key, payload: payload, expireAt: expireAt}
+	sh.items[key] = item
+	heap.Push(&sh.heap, item)
+}
+
+func (sh *shard) delete(key string) {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if item, ok := sh.items[key]; ok {
+		heap.Remove(&sh.heap, item.index)
+		delete(sh.items, key)
+	}
+}
+
+func (sh *shard) deletePrefix(prefix string) {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	for key, item := range sh.items {
+		if strings.HasPrefix(key, prefix) {
+			heap.Remove(&sh.heap, item.index)
+			delete(sh.items, key)
+		}
+	}
+}
+
+func (sh *shard) removeExpired(now int64) {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	for len(sh.heap) > 0 && sh.heap[0].expireAt <= now {
+		item := heap.Pop(&sh.heap).(*shardItem)
+		delete(sh.items, item.key)
+	}
+}
+
+// expiryHeap orders the items by expiration, the earliest first
+type expiryHeap []*shardItem
+
+func (h expiryHeap) Len() int {
+	return len(h)
+}
+
+func (h expiryHeap) Less(i, j int) bool {
+	return h[i].expireAt < h[j].expireAt
+}
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap) Push(x interface{}) {
+	item := x.(*shardItem)
+	item.index = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
@@ -0,0 +1,167 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package persist
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+)
+
+func TestShardedStore(t *testing.T) {
+	store := NewShardedStore(time.Minute, WithShards(10))
+	defer store.Close()
+	assert.DeepEqual(t, 16, len(store.shards))
+
+	ctx := context.Background()
+	assert.Nil(t, store.Set(ctx, "test", "123", 100*time.Millisecond))
+	value := ""
+	assert.Nil(t, store.Get(ctx, "test", &value))
+	assert.DeepEqual(t, "123", value)
+
+	time.Sleep(100 * time.Millisecond)
+	assert.DeepEqual(t, ErrCacheMiss, store.Get(ctx, "test", &value))
+
+	assert.Nil(t, store.Set(ctx, "test", "value", 0))
+	assert.Nil(t, store.Get(ctx, "test", &value))
+	assert.DeepEqual(t, "value", value)
+	assert.Nil(t, store.Delete(ctx, "test"))
+	assert.Nil(t, store.Delete(ctx, "test"))
+	assert.DeepEqual(t, ErrCacheMiss, store.Get(ctx, "test", &value))
+
+	// the readers get their own copy
+	assert.Nil(t, store.Set(ctx, "struct", &testStruct{A: 1}, time.Minute))
+	var dest *testStruct
+	assert.Nil(t, store.Get(ctx, "struct", &dest))
+	dest.A = 2
+	assert.Nil(t, store.Get(ctx, "struct", &dest))
+	assert.DeepEqual(t, 1, dest.A)
+}
+
+func TestShardedStoreCodec(t *testing.T) {
+	store := NewShardedStore(time.Minute)
+	defer store.Close()
+
+	assert.DeepEqual(t, BinaryCodec{}, store.codecFor("binary"))
+	assert.DeepEqual(t, GobCodec{}, store.codecFor(1))
+
+	jsonStore := NewShardedStore(time.Minute, WithShardedCodec(JSONCodec{}))
+	defer jsonStore.Close()
+	assert.DeepEqual(t, JSONCodec{}, jsonStore.codecFor("json"))
+}
+
+func TestShardedStoreCleanup(t *testing.T) {
+	store := NewShardedStore(time.Minute, WithShards(4), WithCleanupInterval(10*time.Millisecond))
+	defer store.Close()
+
+	ctx := context.Background()
+	for i := 0; i < 100; i++ {
+		ttl := time.Minute
+		if i%2 == 0 {
+			ttl = 20 * time.Millisecond
+		}
+		assert.Nil(t, store.Set(ctx, strconv.Itoa(i), i, ttl))
+	}
+	// updating the expiration keeps the entry
+	assert.Nil(t, store.Set(ctx, "0", 0, time.Minute))
+	assert.DeepEqual(t, 100, store.Len())
+
+	time.Sleep(100 * time.Millisecond)
+	assert.DeepEqual(t, 51, store.Len())
+	value := 0
+	assert.Nil(t, store.Get(ctx, "0", &value))
+	assert.DeepEqual(t, ErrCacheMiss, store.Get(ctx, "2", &value))
+
+	assert.Nil(t, store.Close())
+	assert.Nil(t, store.Close())
+}
+
+func benchmarkStoreParallel(b *testing.B, store CacheStore) {
+	ctx := context.Background()
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = "/cache?uid=" + strconv.Itoa(i)
+		if err := store.Set(ctx, keys[i], keys[i], time.Minute); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	var seq uint64
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		value := ""
+		i := atomic.AddUint64(&seq, 1) * 7919
+		for pb.Next() {
+			i++
+			key := keys[i%uint64(len(keys))]
+			// 90% reads, 10% writes
+			if i%10 == 0 {
+				_ = store.Set(ctx, key, key, time.Minute)
+			} else {
+				_ = store.Get(ctx, key, &value)
+			}
+		}
+	})
+}
+
+func BenchmarkShardedStoreParallel(b *testing.B) {
+	store := NewShardedStore(time.Minute)
+	defer store.Close()
+	benchmarkStoreParallel(b, store)
+}
+
+func BenchmarkMemoryStoreParallel(b *testing.B) {
+	benchmarkStoreParallel(b, NewMemoryStore(time.Minute))
+}
+
+func TestShardedStoreNonPositiveCleanupInterval(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Second} {
+		store := NewShardedStore(time.Minute, WithCleanupInterval(interval))
+		assert.DeepEqual(t, defaultCleanupInterval, store.options.CleanupInterval)
+		assert.Nil(t, store.Set(context.Background(), "test", "value", time.Minute))
+		assert.Nil(t, store.Close())
+	}
+}
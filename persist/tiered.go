@@ -0,0 +1,273 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package persist
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/go-redis/redis/v8"
+	"github.com/jellydator/ttlcache/v2"
+)
+
+const (
+	defaultTieredL1TTL   = 10 * time.Second
+	defaultTieredChannel = "hertz-cache:invalidate"
+
+	subscribeErrorFormat  = "[CACHE] subscribe invalidation channel error: %s, channel: %s"
+	publishErrorFormat    = "[CACHE] publish invalidation error: %s, cache key: %s"
+	invalidateErrorFormat = "[CACHE] invalidate l1 cache error: %s, payload: %s"
+	setL1ErrorFormat      = "[CACHE] set l1 cache error: %s, cache key: %s"
+	promoteErrorFormat    = "[CACHE] promote into l1 cache error: %s, cache key: %s"
+	getL1ErrorFormat      = "[CACHE] get l1 cache error: %s, cache key: %s"
+)
+
+// TieredStoreOptions contains the options of TieredStore
+type TieredStoreOptions struct {
+	// L1TTL the maximum ttl of the entries in L1, it bounds the staleness if an invalidation is lost
+	L1TTL time.Duration
+	// Channel the redis pub/sub channel the invalidations are published on
+	Channel string
+	// NodeID identifies this instance, the invalidations published by itself are ignored
+	NodeID string
+}
+
+// TieredStoreOption represents the optional function of TieredStore.
+type TieredStoreOption struct {
+	F func(o *TieredStoreOptions)
+}
+
+// WithTieredL1TTL set up the maximum ttl of the entries in L1, default is 10s
+func WithTieredL1TTL(ttl time.Duration) TieredStoreOption {
+	return TieredStoreOption{F: func(o *TieredStoreOptions) {
+		o.L1TTL = ttl
+	}}
+}
+
+// WithTieredChannel set up the pub/sub channel of the invalidations, default is "hertz-cache:invalidate"
+func WithTieredChannel(channel string) TieredStoreOption {
+	return TieredStoreOption{F: func(o *TieredStoreOptions) {
+		o.Channel = channel
+	}}
+}
+
+// WithTieredNodeID set up the id of this instance, default is a random one
+func WithTieredNodeID(id string) TieredStoreOption {
+	return TieredStoreOption{F: func(o *TieredStoreOptions) {
+		o.NodeID = id
+	}}
+}
+
+// invalidation is the message published when a key is written or deleted, or the keys with a prefix are deleted
+type invalidation struct {
+	Node   string `json:"node"`
+	Key    string `json:"key"`
+	Prefix bool   `json:"prefix,omitempty"`
+}
+
+// TieredStore store http response in a local L1 in front of redis L2.
+// Reads go to L1 then L2, promoting L2 hits into L1. Writes and deletes go to both,
+// and the L1 of the other instances are invalidated through redis pub/sub.
+type TieredStore struct {
+	L1 *MemoryStore
+	L2 *RedisStore
+
+	options TieredStoreOptions
+	pubsub  *redis.PubSub
+	wg      sync.WaitGroup
+}
+
+// NewTieredStore create a tiered store, and subscribe the invalidation channel with the redis client of l2
+func NewTieredStore(l1 *MemoryStore, l2 *RedisStore, opts ...TieredStoreOption) *TieredStore {
+	options := TieredStoreOptions{
+		L1TTL:   defaultTieredL1TTL,
+		Channel: defaultTieredChannel,
+	}
+	for _, opt := range opts {
+		opt.F(&options)
+	}
+	if options.NodeID == "" {
+		options.NodeID, _ = randomOwner()
+	}
+
+	store := &TieredStore{
+		L1:      l1,
+		L2:      l2,
+		options: options,
+		pubsub:  l2.RedisClient.Subscribe(context.Background(), options.Channel),
+	}
+
+	// wait for the confirmation, so that no invalidation is missed after the store is returned
+	if _, err := store.pubsub.Receive(context.Background()); err != nil {
+		hlog.Errorf(subscribeErrorFormat, err, options.Channel)
+	}
+
+	store.wg.Add(1)
+	go store.subscribe()
+
+	return store
+}
+
+// NodeID returns the id of this instance
+func (store *TieredStore) NodeID() string {
+	return store.options.NodeID
+}
+
+func (store *TieredStore) subscribe() {
+	defer store.wg.Done()
+	for msg := range store.pubsub.Channel() {
+		var inv invalidation
+		if err := json.Unmarshal([]byte(msg.Payload), &inv); err != nil {
+			hlog.Errorf(invalidateErrorFormat, err, msg.Payload)
+			continue
+		}
+		if inv.Node == store.options.NodeID {
+			continue
+		}
+		var err error
+		if inv.Prefix {
+			err = store.L1.DeletePrefix(context.Background(), inv.Key)
+		} else {
+			err = store.L1.Delete(context.Background(), inv.Key)
+		}
+		if err != nil && !errors.Is(err, ttlcache.ErrNotFound) {
+			hlog.Errorf(invalidateErrorFormat, err, msg.Payload)
+		}
+	}
+}
+
+// publish notifies the other instances to drop key from their L1.
+// The failures are only logged, the stale entries expire after L1TTL at most.
+func (store *TieredStore) publish(ctx context.Context, key string, prefix bool) {
+	payload, _ := json.Marshal(invalidation{Node: store.options.NodeID, Key: key, Prefix: prefix})
+	if err := store.L2.RedisClient.Publish(ctx, store.options.Channel, payload).Err(); err != nil {
+		hlog.CtxErrorf(ctx, publishErrorFormat, err, key)
+	}
+}
+
+// l1TTL returns the ttl of an entry in L1, which never outlives L2
+func (store *TieredStore) l1TTL(expire time.Duration) time.Duration {
+	if expire <= 0 || expire > store.options.L1TTL {
+		return store.options.L1TTL
+	}
+	return expire
+}
+
+// Set put key value pair to L2 then L1, and invalidate the L1 of the other instances.
+// The failures of L1 are only logged and the previous L1 entry is dropped, the value is read from L2 then.
+func (store *TieredStore) Set(ctx context.Context, key string, value interface{}, expire time.Duration) error {
+	if err := store.L2.Set(ctx, key, value, expire); err != nil {
+		return err
+	}
+	if err := store.L1.Set(ctx, key, value, store.l1TTL(expire)); err != nil {
+		hlog.CtxErrorf(ctx, setL1ErrorFormat, err, key)
+		_ = store.L1.Delete(ctx, key)
+	}
+	store.publish(ctx, key, false)
+	return nil
+}
+
+// Delete remove key from L2 and L1, and invalidate the L1 of the other instances
+func (store *TieredStore) Delete(ctx context.Context, key string) error {
+	if err := store.L2.Delete(ctx, key); err != nil {
+		return err
+	}
+	if err := store.L1.Delete(ctx, key); err != nil && !errors.Is(err, ttlcache.ErrNotFound) {
+		return err
+	}
+	store.publish(ctx, key, false)
+	return nil
+}
+
+// DeletePrefix remove the keys starting with prefix from L2 and L1, and invalidate them in the L1 of the other instances
+func (store *TieredStore) DeletePrefix(ctx context.Context, prefix string) error {
+	if err := store.L2.DeletePrefix(ctx, prefix); err != nil {
+		return err
+	}
+	if err := store.L1.DeletePrefix(ctx, prefix); err != nil {
+		return err
+	}
+	store.publish(ctx, prefix, true)
+	return nil
+}
+
+// Get retrieves an item from L1, or from L2 and promote it into L1 for at most its remaining ttl in L2.
+// If key doesn't exist in both, return ErrCacheMiss. The failures of L1 are only logged and read L2.
+func (store *TieredStore) Get(ctx context.Context, key string, value interface{}) error {
+	err := store.L1.Get(ctx, key, value)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, ErrCacheMiss) {
+		hlog.CtxErrorf(ctx, getL1ErrorFormat, err, key)
+	}
+
+	ttl, err := store.L2.getWithTTL(ctx, key, value)
+	if err != nil {
+		return err
+	}
+	// the entry expires in L2 before it could be promoted
+	if ttl == 0 {
+		return nil
+	}
+	if err := store.L1.Set(ctx, key, reflect.ValueOf(value).Elem().Interface(), store.l1TTL(ttl)); err != nil {
+		hlog.CtxErrorf(ctx, promoteErrorFormat, err, key)
+	}
+	return nil
+}
+
+// Close unsubscribe the invalidation channel, then close L1 and L2
+func (store *TieredStore) Close() error {
+	err := store.pubsub.Close()
+	store.wg.Wait()
+	if l1Err := store.L1.Close(); err == nil {
+		err = l1Err
+	}
+	if l2Err := store.L2.Close(); err == nil {
+		err = l2Err
+	}
+	return err
+}
@@ -0,0 +1,204 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package persist
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/go-redis/redis/v8"
+)
+
+func newTestTieredStore(nodeID string) *TieredStore {
+	return NewTieredStore(NewMemoryStore(time.Minute), NewRedisStore(redis.NewClient(&redis.Options{
+		Addr: "127.0.0.1:6379",
+	})), WithTieredNodeID(nodeID), WithTieredChannel("test-tiered"), WithTieredL1TTL(time.Second))
+}
+
+func waitL1Miss(t *testing.T, store *TieredStore, key string) {
+	value := ""
+	for i := 0; i < 100; i++ {
+		if store.L1.Get(context.Background(), key, &value) == ErrCacheMiss {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("l1 of node %s is not invalidated", store.NodeID())
+}
+
+func TestTieredStore(t *testing.T) {
+	ctx := context.Background()
+	store := newTestTieredStore("node-a")
+	defer store.Close()
+
+	assert.Nil(t, store.Set(ctx, "tiered", "value", time.Minute))
+	value := ""
+	assert.Nil(t, store.L1.Get(ctx, "tiered", &value))
+	assert.DeepEqual(t, "value", value)
+
+	// the ttl of L1 is bounded
+	_, ttl, err := store.L1.Cache.GetWithTTL("tiered")
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0 && ttl <= time.Second)
+
+	// promote L2 hits into L1
+	assert.Nil(t, store.L1.Delete(ctx, "tiered"))
+	value = ""
+	assert.Nil(t, store.Get(ctx, "tiered", &value))
+	assert.DeepEqual(t, "value", value)
+	value = ""
+	assert.Nil(t, store.L1.Get(ctx, "tiered", &value))
+	assert.DeepEqual(t, "value", value)
+
+	assert.Nil(t, store.Delete(ctx, "tiered"))
+	assert.DeepEqual(t, ErrCacheMiss, store.Get(ctx, "tiered", &value))
+	assert.Nil(t, store.Delete(ctx, "tiered"))
+}
+
+func TestTieredStoreL1TTL(t *testing.T) {
+	store := newTestTieredStore("node-ttl")
+	defer store.Close()
+
+	assert.DeepEqual(t, time.Second, store.l1TTL(time.Minute))
+	assert.DeepEqual(t, 500*time.Millisecond, store.l1TTL(500*time.Millisecond))
+	assert.DeepEqual(t, time.Second, store.l1TTL(0))
+}
+
+func TestTieredStoreInvalidation(t *testing.T) {
+	ctx := context.Background()
+	nodeA := newTestTieredStore("node-a")
+	defer nodeA.Close()
+	nodeB := newTestTieredStore("node-b")
+	defer nodeB.Close()
+
+	assert.Nil(t, nodeA.Set(ctx, "tiered-inv", "v1", time.Minute))
+	value := ""
+	assert.Nil(t, nodeB.Get(ctx, "tiered-inv", &value))
+	assert.DeepEqual(t, "v1", value)
+
+	// a write on node a drops the entry from the L1 of node b
+	assert.Nil(t, nodeA.Set(ctx, "tiered-inv", "v2", time.Minute))
+	waitL1Miss(t, nodeB, "tiered-inv")
+	assert.Nil(t, nodeB.Get(ctx, "tiered-inv", &value))
+	assert.DeepEqual(t, "v2", value)
+
+	// node a ignores its own invalidations
+	assert.Nil(t, nodeA.L1.Get(ctx, "tiered-inv", &value))
+	assert.DeepEqual(t, "v2", value)
+
+	assert.Nil(t, nodeA.Delete(ctx, "tiered-inv"))
+	waitL1Miss(t, nodeB, "tiered-inv")
+	assert.DeepEqual(t, ErrCacheMiss, nodeB.Get(ctx, "tiered-inv", &value))
+}
+
+func TestTieredStorePromotionTTL(t *testing.T) {
+	ctx := context.Background()
+	store := newTestTieredStore("node-promote")
+	defer store.Close()
+
+	// the promoted entry does not outlive its remaining ttl in L2
+	assert.Nil(t, store.L2.Set(ctx, "tiered-promote", "value", 300*time.Millisecond))
+	value := ""
+	assert.Nil(t, store.Get(ctx, "tiered-promote", &value))
+	_, ttl, err := store.L1.Cache.GetWithTTL("tiered-promote")
+	assert.Nil(t, err)
+	assert.True(t, ttl > 0 && ttl <= 300*time.Millisecond)
+
+	// the entries without expiration in L2 are promoted for L1TTL
+	assert.Nil(t, store.L2.Set(ctx, "tiered-promote", "value", 0))
+	assert.Nil(t, store.L1.Delete(ctx, "tiered-promote"))
+	assert.Nil(t, store.Get(ctx, "tiered-promote", &value))
+	_, ttl, err = store.L1.Cache.GetWithTTL("tiered-promote")
+	assert.Nil(t, err)
+	assert.True(t, ttl > 300*time.Millisecond && ttl <= time.Second)
+
+	assert.Nil(t, store.Delete(ctx, "tiered-promote"))
+}
+
+func TestTieredStoreL1Failure(t *testing.T) {
+	ctx := context.Background()
+	client := redis.NewClient(&redis.Options{
+		Addr: "127.0.0.1:6379",
+	})
+	nodeA := NewTieredStore(NewMemoryStore(time.Minute, WithMaxBytes(4)), NewRedisStore(client),
+		WithTieredNodeID("node-small"), WithTieredChannel("test-tiered"))
+	defer nodeA.Close()
+	nodeB := newTestTieredStore("node-b")
+	defer nodeB.Close()
+
+	assert.Nil(t, nodeB.Set(ctx, "tiered-large", "v1", time.Minute))
+	value := ""
+	assert.Nil(t, nodeB.Get(ctx, "tiered-large", &value))
+
+	// the entry too large for L1 is still written to L2 and invalidated on the other instances
+	assert.Nil(t, nodeA.Set(ctx, "tiered-large", "too large", time.Minute))
+	waitL1Miss(t, nodeB, "tiered-large")
+
+	// the hit in L2 is returned even if it can not be promoted
+	value = ""
+	assert.Nil(t, nodeA.Get(ctx, "tiered-large", &value))
+	assert.DeepEqual(t, "too large", value)
+
+	assert.Nil(t, nodeA.Delete(ctx, "tiered-large"))
+}
+
+func TestTieredStoreL1Error(t *testing.T) {
+	ctx := context.Background()
+	store := newTestTieredStore("node-l1-error")
+	defer store.Close()
+
+	// a value of another type in L1 is read from L2
+	assert.Nil(t, store.L2.Set(ctx, "tiered-l1-error", "value", time.Minute))
+	assert.Nil(t, store.L1.Set(ctx, "tiered-l1-error", 1, time.Minute))
+	value := ""
+	assert.Nil(t, store.Get(ctx, "tiered-l1-error", &value))
+	assert.DeepEqual(t, "value", value)
+
+	// a closed L1 is bypassed
+	assert.Nil(t, store.L1.Close())
+	value = ""
+	assert.Nil(t, store.Get(ctx, "tiered-l1-error", &value))
+	assert.DeepEqual(t, "value", value)
+
+	assert.Nil(t, store.L2.Delete(ctx, "tiered-l1-error"))
+}
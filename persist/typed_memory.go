@@ -0,0 +1,107 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package persist
+
+import (
+	"context"
+	"reflect"
+	"time"
+)
+
+// TypedMemoryStore is a MemoryStore holding values of type T, which reads them without reflection
+// unless the values are isolated.
+// It supports the same options, including the bounds and the eviction policies.
+type TypedMemoryStore[T any] struct {
+	store *MemoryStore
+}
+
+// NewTypedMemoryStore allocate a typed local memory store with default expiration
+func NewTypedMemoryStore[T any](defaultExpiration time.Duration, opts ...MemoryStoreOption) *TypedMemoryStore[T] {
+	return &TypedMemoryStore[T]{
+		store: NewMemoryStore(defaultExpiration, opts...),
+	}
+}
+
+// Set put key value pair to memory store, and expire after expireDuration
+func (s *TypedMemoryStore[T]) Set(ctx context.Context, key string, value T, expireDuration time.Duration) error {
+	return s.store.Set(ctx, key, value, expireDuration)
+}
+
+// Delete remove key in memory store, do nothing if key doesn't exist
+func (s *TypedMemoryStore[T]) Delete(ctx context.Context, key string) error {
+	return s.store.Delete(ctx, key)
+}
+
+// Get get key in memory store, if key doesn't exist, return the zero value and ErrCacheMiss
+func (s *TypedMemoryStore[T]) Get(ctx context.Context, key string) (T, error) {
+	var zero T
+	if s.store.options.Isolation != IsolationShared {
+		var value T
+		if err := s.store.Get(ctx, key, &value); err != nil {
+			return zero, err
+		}
+		return value, nil
+	}
+
+	val, err := s.store.load(key)
+	if err != nil {
+		return zero, err
+	}
+	if val == nil {
+		return zero, nil
+	}
+	value, ok := val.(T)
+	if !ok {
+		return zero, &TypeMismatchError{Key: key, Stored: reflect.TypeOf(val), Target: reflect.TypeOf(&zero).Elem()}
+	}
+	return value, nil
+}
+
+// Close stops the background goroutine of the underlying store
+func (s *TypedMemoryStore[T]) Close() error {
+	return s.store.Close()
+}
+
+// MemoryStore returns the underlying store, e.g. to be used as a CacheStore by the middleware.
+// The values set through it must be of type T.
+func (s *TypedMemoryStore[T]) MemoryStore() *MemoryStore {
+	return s.store
+}
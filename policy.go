@@ -0,0 +1,117 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package cache
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/hertz-contrib/cache/persist"
+)
+
+// StoreErrorPolicy decides how the middleware reacts to a failed cache store operation
+type StoreErrorPolicy int
+
+const (
+	// StoreErrorPolicyFailOpen treats the failure as a cache miss and calls the backend
+	StoreErrorPolicyFailOpen StoreErrorPolicy = iota
+	// StoreErrorPolicyFailClosed aborts the request with 503 Service Unavailable when the lookup fails.
+	// A failed write is logged only since the response has already been generated.
+	StoreErrorPolicyFailClosed
+	// StoreErrorPolicyBypass calls the backend and skips the failed store for the bypass duration,
+	// see WithStoreBypassDuration
+	StoreErrorPolicyBypass
+)
+
+// defaultStoreBypassDuration the time to skip a failed store with StoreErrorPolicyBypass
+const defaultStoreBypassDuration = 10 * time.Second
+
+// BypassReasonStoreUnavailable the cache store is skipped after a failure, see StoreErrorPolicyBypass
+const BypassReasonStoreUnavailable BypassReason = "store_unavailable"
+
+// StoreErrorPolicyFunc returns the policy for the failed store operation ("get", "set" or "delete").
+// The error can be inspected with persist.ErrConnection, persist.ErrTimeout and persist.ErrSerialization.
+type StoreErrorPolicyFunc func(op string, err error) StoreErrorPolicy
+
+var defaultStoreErrorPolicyFunc = func(op string, err error) StoreErrorPolicy {
+	return StoreErrorPolicyFailOpen
+}
+
+// OnStoreErrorCallback define the callback when a cache store operation ("get", "set" or "delete") fails
+type OnStoreErrorCallback func(ctx context.Context, c *app.RequestContext, op string, err error)
+
+var defaultStoreErrorCallback = func(ctx context.Context, c *app.RequestContext, op string, err error) {}
+
+// storeBypass records the stores skipped until a deadline
+type storeBypass struct {
+	deadlines sync.Map // persist.CacheStore -> time.Time
+}
+
+func (b *storeBypass) mark(store persist.CacheStore, d time.Duration) {
+	if !isComparableStore(store) {
+		return
+	}
+	b.deadlines.Store(store, time.Now().Add(d))
+}
+
+func (b *storeBypass) active(store persist.CacheStore) bool {
+	if !isComparableStore(store) {
+		return false
+	}
+
+	deadline, ok := b.deadlines.Load(store)
+	if !ok {
+		return false
+	}
+	if time.Now().Before(deadline.(time.Time)) {
+		return true
+	}
+	b.deadlines.Delete(store)
+	return false
+}
+
+// isComparableStore reports whether the store can be used as a map key
+func isComparableStore(store persist.CacheStore) bool {
+	return store != nil && reflect.TypeOf(store).Comparable()
+}
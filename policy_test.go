@@ -0,0 +1,139 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/hertz-contrib/cache/persist"
+)
+
+// countingFailingStore fails every operation and counts the calls
+type countingFailingStore struct {
+	failingStore
+	calls int32
+}
+
+func (s *countingFailingStore) Get(ctx context.Context, key string, value interface{}) error {
+	atomic.AddInt32(&s.calls, 1)
+	return &persist.StoreError{Op: "get", Kind: persist.ErrConnection, Err: errStoreUnavailable}
+}
+
+func TestStoreErrorPolicyFailOpen(t *testing.T) {
+	var errCount int32
+	handler := hertzHandler(NewCacheByRequestURI(failingStore{}, 3*time.Second,
+		WithOnStoreError(func(ctx context.Context, c *app.RequestContext, op string, err error) {
+			atomic.AddInt32(&errCount, 1)
+			assert.True(t, errors.Is(err, errStoreUnavailable))
+		}),
+	), false)
+
+	w := ut.PerformRequest(handler, "GET", "/cache?uid=1", nil)
+	assert.DeepEqual(t, http.StatusOK, w.Code)
+	assert.DeepEqual(t, "uid:1", w.Body.String())
+	assert.DeepEqual(t, int32(2), errCount)
+}
+
+func TestStoreErrorPolicyFailClosed(t *testing.T) {
+	handler := hertzHandler(NewCacheByRequestURI(failingStore{}, 3*time.Second,
+		WithStoreErrorPolicy(StoreErrorPolicyFailClosed),
+	), false)
+
+	w := ut.PerformRequest(handler, "GET", "/cache?uid=1", nil)
+	assert.DeepEqual(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestStoreErrorPolicyBypass(t *testing.T) {
+	store := &countingFailingStore{}
+	handler := hertzHandler(NewCacheByRequestURI(store, 3*time.Second,
+		WithStoreErrorPolicyFunc(func(op string, err error) StoreErrorPolicy {
+			if errors.Is(err, persist.ErrConnection) {
+				return StoreErrorPolicyBypass
+			}
+			return StoreErrorPolicyFailClosed
+		}),
+		WithStoreBypassDuration(100*time.Millisecond),
+	), false)
+
+	for i := 0; i < 3; i++ {
+		w := ut.PerformRequest(handler, "GET", "/cache?uid=1", nil)
+		assert.DeepEqual(t, "uid:1", w.Body.String())
+	}
+	assert.DeepEqual(t, int32(1), atomic.LoadInt32(&store.calls))
+
+	time.Sleep(100 * time.Millisecond)
+	ut.PerformRequest(handler, "GET", "/cache?uid=1", nil)
+	assert.DeepEqual(t, int32(2), atomic.LoadInt32(&store.calls))
+}
+
+func TestStoreErrorPolicyDecryptionIsMiss(t *testing.T) {
+	keyring, err := persist.NewKeyring(1, map[byte][]byte{1: []byte("0123456789abcdef")})
+	assert.Nil(t, err)
+	memoryStore := persist.NewMemoryStore(time.Minute)
+	assert.Nil(t, memoryStore.Set(context.Background(), "/cache?uid=1", []byte("garbage"), time.Minute))
+
+	var kinds []EventKind
+	handler := hertzHandler(NewCacheByRequestURI(persist.NewEncryptedStore(memoryStore, keyring), 3*time.Second,
+		WithStoreErrorPolicy(StoreErrorPolicyFailClosed),
+		WithOnEvent(func(ctx context.Context, c *app.RequestContext, event Event) {
+			kinds = append(kinds, event.Kind)
+			if event.Kind == EventStoreError {
+				assert.True(t, errors.Is(event.Err, persist.ErrDecryption))
+			}
+		}),
+	), false)
+
+	// the entry failing to decrypt is regenerated despite the fail closed policy
+	w := ut.PerformRequest(handler, "GET", "/cache?uid=1", nil)
+	assert.DeepEqual(t, http.StatusOK, w.Code)
+	assert.DeepEqual(t, "uid:1", w.Body.String())
+	w = ut.PerformRequest(handler, "GET", "/cache?uid=1", nil)
+	assert.DeepEqual(t, "uid:1", w.Body.String())
+	assert.DeepEqual(t, []EventKind{EventStoreError, EventMiss, EventSet, EventHit}, kinds)
+}
@@ -0,0 +1,310 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+)
+
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultLatencyBuckets the default buckets in seconds of the store latency histogram
+var DefaultLatencyBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1}
+
+// PrometheusMetrics is a MetricsRecorder keeping the metrics in memory and
+// exporting them in the Prometheus text exposition format.
+type PrometheusMetrics struct {
+	hits         *counterVec
+	misses       *counterVec
+	shared       *counterVec
+	bypasses     *counterVec
+	storeErrors  *counterVec
+	storedBytes  *counterVec
+	storeLatency *histogramVec
+}
+
+// NewPrometheusMetrics create a PrometheusMetrics, buckets are the upper bounds in seconds of
+// the store latency histogram, DefaultLatencyBuckets is used if empty
+func NewPrometheusMetrics(buckets ...float64) *PrometheusMetrics {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+
+	return &PrometheusMetrics{
+		hits:         newCounterVec("hertz_cache_hits_total", "Total number of responses replied from the cache store.", "route", "store"),
+		misses:       newCounterVec("hertz_cache_misses_total", "Total number of cache misses.", "route", "store"),
+		shared:       newCounterVec("hertz_cache_shared_total", "Total number of responses shared from an in-flight request.", "route", "store"),
+		bypasses:     newCounterVec("hertz_cache_bypasses_total", "Total number of requests passed through without caching.", "route", "store", "reason"),
+		storeErrors:  newCounterVec("hertz_cache_store_errors_total", "Total number of failed cache store operations.", "route", "store", "op"),
+		storedBytes:  newCounterVec("hertz_cache_stored_bytes_total", "Total number of response body bytes written to the cache store.", "route", "store"),
+		storeLatency: newHistogramVec("hertz_cache_store_latency_seconds", "Latency of the cache store operations.", buckets, "route", "store", "op"),
+	}
+}
+
+func (m *PrometheusMetrics) IncHit(labels MetricsLabels) {
+	m.hits.add(1, labels.Route, labels.Store)
+}
+
+func (m *PrometheusMetrics) IncMiss(labels MetricsLabels) {
+	m.misses.add(1, labels.Route, labels.Store)
+}
+
+func (m *PrometheusMetrics) IncShared(labels MetricsLabels) {
+	m.shared.add(1, labels.Route, labels.Store)
+}
+
+func (m *PrometheusMetrics) IncBypass(labels MetricsLabels, reason BypassReason) {
+	m.bypasses.add(1, labels.Route, labels.Store, string(reason))
+}
+
+func (m *PrometheusMetrics) IncStoreError(labels MetricsLabels, op string) {
+	m.storeErrors.add(1, labels.Route, labels.Store, op)
+}
+
+func (m *PrometheusMetrics) ObserveStoreLatency(labels MetricsLabels, op string, latency time.Duration) {
+	m.storeLatency.observe(latency.Seconds(), labels.Route, labels.Store, op)
+}
+
+func (m *PrometheusMetrics) AddStoredBytes(labels MetricsLabels, n int) {
+	m.storedBytes.add(float64(n), labels.Route, labels.Store)
+}
+
+// WriteTo writes all metrics in the Prometheus text exposition format
+func (m *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, c := range []*counterVec{m.hits, m.misses, m.shared, m.bypasses, m.storeErrors, m.storedBytes} {
+		c.write(bw)
+	}
+	m.storeLatency.write(bw)
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// Handler returns a hertz handler serving the metrics, e.g. h.GET("/metrics", m.Handler())
+func (m *PrometheusMetrics) Handler() app.HandlerFunc {
+	return func(ctx context.Context, c *app.RequestContext) {
+		var buf bytes.Buffer
+		_, _ = m.WriteTo(&buf)
+		c.Data(consts.StatusOK, prometheusContentType, buf.Bytes())
+	}
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+type counterValue struct {
+	labelValues []string
+	value       float64
+}
+
+type counterVec struct {
+	name       string
+	help       string
+	labelNames []string
+
+	mu     sync.Mutex
+	values map[string]*counterValue
+}
+
+func newCounterVec(name, help string, labelNames ...string) *counterVec {
+	return &counterVec{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		values:     make(map[string]*counterValue),
+	}
+}
+
+func (v *counterVec) add(delta float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	cv, ok := v.values[key]
+	if !ok {
+		cv = &counterValue{labelValues: labelValues}
+		v.values[key] = cv
+	}
+	cv.value += delta
+}
+
+func (v *counterVec) write(w *bufio.Writer) {
+	writeMetricHeader(w, v.name, v.help, "counter")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, key := range sortedKeys(v.values) {
+		cv := v.values[key]
+		writeSample(w, v.name, v.labelNames, cv.labelValues, "", "", cv.value)
+	}
+}
+
+type histogramValue struct {
+	labelValues []string
+	counts      []uint64
+	sum         float64
+	count       uint64
+}
+
+type histogramVec struct {
+	name       string
+	help       string
+	labelNames []string
+	buckets    []float64
+
+	mu     sync.Mutex
+	values map[string]*histogramValue
+}
+
+func newHistogramVec(name, help string, buckets []float64, labelNames ...string) *histogramVec {
+	return &histogramVec{
+		name:       name,
+		help:       help,
+		labelNames: labelNames,
+		buckets:    buckets,
+		values:     make(map[string]*histogramValue),
+	}
+}
+
+func (v *histogramVec) observe(value float64, labelValues ...string) {
+	key := strings.Join(labelValues, "\xff")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	hv, ok := v.values[key]
+	if !ok {
+		hv = &histogramValue{labelValues: labelValues, counts: make([]uint64, len(v.buckets))}
+		v.values[key] = hv
+	}
+	for i, upper := range v.buckets {
+		if value <= upper {
+			hv.counts[i]++
+		}
+	}
+	hv.sum += value
+	hv.count++
+}
+
+func (v *histogramVec) write(w *bufio.Writer) {
+	writeMetricHeader(w, v.name, v.help, "histogram")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for _, key := range sortedKeys(v.values) {
+		hv := v.values[key]
+		for i, upper := range v.buckets {
+			writeSample(w, v.name+"_bucket", v.labelNames, hv.labelValues, "le", formatFloat(upper), float64(hv.counts[i]))
+		}
+		writeSample(w, v.name+"_bucket", v.labelNames, hv.labelValues, "le", "+Inf", float64(hv.count))
+		writeSample(w, v.name+"_sum", v.labelNames, hv.labelValues, "", "", hv.sum)
+		writeSample(w, v.name+"_count", v.labelNames, hv.labelValues, "", "", float64(hv.count))
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func writeMetricHeader(w *bufio.Writer, name, help, typ string) {
+	w.WriteString("# HELP " + name + " " + help + "\n")
+	w.WriteString("# TYPE " + name + " " + typ + "\n")
+}
+
+func writeSample(w *bufio.Writer, name string, labelNames, labelValues []string, extraName, extraValue string, value float64) {
+	w.WriteString(name)
+	w.WriteByte('{')
+	for i, labelName := range labelNames {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		w.WriteString(labelName + `="` + escapeLabelValue(labelValues[i]) + `"`)
+	}
+	if extraName != "" {
+		w.WriteString(`,` + extraName + `="` + extraValue + `"`)
+	}
+	w.WriteString("} ")
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(s string) string {
+	return labelValueReplacer.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
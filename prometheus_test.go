@@ -0,0 +1,98 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package cache
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/hertz-contrib/cache/persist"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	metrics := NewPrometheusMetrics()
+	memoryStore := persist.NewMemoryStore(1 * time.Minute)
+	handler := hertzHandler(NewCacheByRequestURI(memoryStore, 1*time.Minute, WithMetrics(metrics)), true)
+	handler.GET("/metrics", metrics.Handler())
+
+	ut.PerformRequest(handler, "GET", "/cache?uid=1", nil)
+	ut.PerformRequest(handler, "GET", "/cache?uid=1", nil)
+	ut.PerformRequest(handler, "GET", "/cache?uid=1", nil)
+
+	var buf bytes.Buffer
+	n, err := metrics.WriteTo(&buf)
+	assert.Nil(t, err)
+	assert.DeepEqual(t, int64(buf.Len()), n)
+
+	output := buf.String()
+	assert.True(t, strings.Contains(output, "# TYPE hertz_cache_hits_total counter\n"))
+	assert.True(t, strings.Contains(output, `hertz_cache_hits_total{route="/cache",store="MemoryStore"} 2`))
+	assert.True(t, strings.Contains(output, `hertz_cache_misses_total{route="/cache",store="MemoryStore"} 1`))
+	assert.True(t, strings.Contains(output, `hertz_cache_stored_bytes_total{route="/cache",store="MemoryStore"} `))
+	assert.True(t, strings.Contains(output, `hertz_cache_store_latency_seconds_bucket{route="/cache",store="MemoryStore",op="get",le="+Inf"} 3`))
+	assert.True(t, strings.Contains(output, `hertz_cache_store_latency_seconds_count{route="/cache",store="MemoryStore",op="set"} 1`))
+
+	w := ut.PerformRequest(handler, "GET", "/metrics", nil)
+	assert.DeepEqual(t, prometheusContentType, w.Header().Get("Content-Type"))
+	assert.True(t, strings.Contains(w.Body.String(), "hertz_cache_bypasses_total"))
+}
+
+func TestPrometheusHistogram(t *testing.T) {
+	metrics := NewPrometheusMetrics(0.1, 0.01)
+	labels := MetricsLabels{Route: "/a", Store: `s"1`}
+	metrics.ObserveStoreLatency(labels, storeOpGet, 5*time.Millisecond)
+	metrics.ObserveStoreLatency(labels, storeOpGet, 50*time.Millisecond)
+	metrics.ObserveStoreLatency(labels, storeOpGet, time.Second)
+
+	var buf bytes.Buffer
+	_, err := metrics.WriteTo(&buf)
+	assert.Nil(t, err)
+
+	output := buf.String()
+	assert.True(t, strings.Contains(output, `hertz_cache_store_latency_seconds_bucket{route="/a",store="s\"1",op="get",le="0.01"} 1`))
+	assert.True(t, strings.Contains(output, `hertz_cache_store_latency_seconds_bucket{route="/a",store="s\"1",op="get",le="0.1"} 2`))
+	assert.True(t, strings.Contains(output, `hertz_cache_store_latency_seconds_bucket{route="/a",store="s\"1",op="get",le="+Inf"} 3`))
+	assert.True(t, strings.Contains(output, `hertz_cache_store_latency_seconds_sum{route="/a",store="s\"1",op="get"} 1.055`))
+}
@@ -0,0 +1,121 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/hertz-contrib/cache/persist"
+)
+
+// ctxAwareStore fails when the context is done, and hangs on Get until then when hang is set
+type ctxAwareStore struct {
+	*persist.MemoryStore
+	hang bool
+}
+
+func (s *ctxAwareStore) Get(ctx context.Context, key string, value interface{}) error {
+	if s.hang {
+		<-ctx.Done()
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.MemoryStore.Get(ctx, key, value)
+}
+
+func (s *ctxAwareStore) Set(ctx context.Context, key string, value interface{}, expire time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.MemoryStore.Set(ctx, key, value, expire)
+}
+
+func TestStoreReadTimeout(t *testing.T) {
+	store := &ctxAwareStore{MemoryStore: persist.NewMemoryStore(time.Minute), hang: true}
+	handler := hertzHandler(NewCacheByRequestURI(store, time.Minute,
+		WithStoreReadTimeout(20*time.Millisecond)), false)
+
+	start := time.Now()
+	w := ut.PerformRequest(handler, "GET", "/cache?uid=1", nil)
+	assert.DeepEqual(t, "uid:1", w.Body.String())
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestDetachedWrite(t *testing.T) {
+	for _, detached := range []bool{false, true} {
+		store := &ctxAwareStore{MemoryStore: persist.NewMemoryStore(time.Minute)}
+		handler := hertzHandler(NewCacheByRequestURI(store, time.Minute,
+			WithDetachedWrite(detached),
+			WithStoreWriteTimeout(time.Second)), false)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		c := handler.NewContext()
+		c.Request.SetRequestURI("/cache?uid=1")
+		handler.ServeHTTP(ctx, c)
+
+		respCache := &ResponseCache{}
+		err := store.MemoryStore.Get(context.Background(), "/cache?uid=1", &respCache)
+		if detached {
+			assert.Nil(t, err)
+		} else {
+			assert.DeepEqual(t, persist.ErrCacheMiss, err)
+		}
+	}
+}
+
+func TestDetachedContext(t *testing.T) {
+	type key struct{}
+	parent, cancel := context.WithTimeout(context.WithValue(context.Background(), key{}, "value"), time.Millisecond)
+	cancel()
+
+	ctx := detachedContext{parent: parent}
+	assert.Nil(t, ctx.Err())
+	assert.Nil(t, ctx.Done())
+	_, ok := ctx.Deadline()
+	assert.False(t, ok)
+	assert.DeepEqual(t, "value", ctx.Value(key{}))
+}
@@ -0,0 +1,111 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package cache
+
+import (
+	"context"
+	"hash/fnv"
+	"strconv"
+)
+
+// span names of the cache operations
+const (
+	SpanNameLookup       = "cache.lookup"
+	SpanNameSingleFlight = "cache.singleflight"
+	SpanNameHandler      = "cache.handler"
+	SpanNameStore        = "cache.store"
+)
+
+// attribute keys attached to the cache spans
+const (
+	AttrKeyHash     = "cache.key_hash"
+	AttrOutcome     = "cache.outcome"
+	AttrStore       = "cache.store"
+	AttrPayloadSize = "cache.payload_size"
+)
+
+// outcomes of the cache spans
+const (
+	OutcomeHit    = "hit"
+	OutcomeMiss   = "miss"
+	OutcomeShared = "shared"
+	OutcomeLeader = "leader"
+	OutcomeStale  = "stale"
+)
+
+// Attribute is a key value pair attached to a Span, Value is one of string, int, int64, float64 and bool
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Tracer starts the spans wrapping the cache lookup, singleflight wait, handler execution and store write.
+// Implementations must be safe for concurrent use.
+type Tracer interface {
+	// Start creates a span as the child of the span in ctx, and returns a context containing the new span
+	Start(ctx context.Context, spanName string) (context.Context, Span)
+}
+
+// Span is the unit of work started by Tracer
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+type noopTracer struct{}
+
+func (noopTracer) Start(ctx context.Context, spanName string) (context.Context, Span) {
+	return ctx, noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttributes(...Attribute) {}
+func (noopSpan) RecordError(error)          {}
+func (noopSpan) End()                       {}
+
+// hashKey hashes the cache key so that the raw key (which may contain private data) is not exported
+func hashKey(key string) string {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	return strconv.FormatUint(h.Sum64(), 16)
+}
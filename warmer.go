@@ -0,0 +1,291 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package cache
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/cloudwego/hertz/pkg/common/hlog"
+	"github.com/cloudwego/hertz/pkg/protocol/consts"
+	"github.com/cloudwego/hertz/pkg/route"
+)
+
+const (
+	warmRequestPanicFormat = "[CACHE] warm request panic: %v, uri: %s"
+	warmRequestFailFormat  = "[CACHE] warm request failed with status %d, uri: %s"
+)
+
+// WarmRequest describes a request replayed by the Warmer
+type WarmRequest struct {
+	// Method if empty, use GET instead
+	Method string
+	// URI the request uri, e.g. /hello?a=1
+	URI string
+	// Host optional host header
+	Host   string
+	Header map[string]string
+}
+
+// WarmResult record the outcome of a warming run
+type WarmResult struct {
+	// Populated the number of requests whose responses are written to a cache store by the run
+	Populated int64
+	// Uncached the number of requests answered with 2xx but not written to a cache store, e.g. they hit the cache,
+	// the strategy or a Cache-Control kept them out of the store, or the write failed
+	Uncached int64
+	// Failed the number of requests answered with non-2xx, panicked or not dispatched
+	Failed int64
+}
+
+// warmRecordKey is the context key of the warmRecord of a request dispatched by the Warmer
+type warmRecordKey struct{}
+
+// warmRecord tracks whether the response of a warm request is written to a cache store,
+// including by an AsyncWriter after the request is served
+type warmRecord struct {
+	stored  int32
+	pending sync.WaitGroup
+}
+
+// warmRecordOf returns the warmRecord of the request dispatched by the Warmer with ctx, nil for the other requests
+func warmRecordOf(ctx context.Context) *warmRecord {
+	record, _ := ctx.Value(warmRecordKey{}).(*warmRecord)
+	return record
+}
+
+// markStored records that the response is written to a cache store
+func (r *warmRecord) markStored() {
+	if r != nil {
+		atomic.StoreInt32(&r.stored, 1)
+	}
+}
+
+// add records a pending async write of the response
+func (r *warmRecord) add() {
+	if r != nil {
+		r.pending.Add(1)
+	}
+}
+
+// done records that a pending async write of the response is finished or dropped
+func (r *warmRecord) done() {
+	if r != nil {
+		r.pending.Done()
+	}
+}
+
+// Warmer pre-populates the cache stores by dispatching requests through the engine's handler chain
+// in-process, so that a node can be warmed up before it joins the load balancer.
+type Warmer struct {
+	engine      *route.Engine
+	concurrency int
+}
+
+// NewWarmer create a Warmer dispatching at most concurrency requests at the same time
+func NewWarmer(engine *route.Engine, concurrency int) *Warmer {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	return &Warmer{
+		engine:      engine,
+		concurrency: concurrency,
+	}
+}
+
+// Warm dispatches all requests and blocks until they finished.
+// The requests left when ctx is done are counted as failed.
+func (w *Warmer) Warm(ctx context.Context, requests []WarmRequest) WarmResult {
+	var result WarmResult
+
+	reqCh := make(chan WarmRequest)
+	wg := sync.WaitGroup{}
+	for i := 0; i < w.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for req := range reqCh {
+				switch ok, stored := w.dispatch(ctx, req); {
+				case !ok:
+					atomic.AddInt64(&result.Failed, 1)
+				case stored:
+					atomic.AddInt64(&result.Populated, 1)
+				default:
+					atomic.AddInt64(&result.Uncached, 1)
+				}
+			}
+		}()
+	}
+
+	dispatched := 0
+dispatch:
+	for _, req := range requests {
+		select {
+		case <-ctx.Done():
+			break dispatch
+		case reqCh <- req:
+			dispatched++
+		}
+	}
+	close(reqCh)
+	wg.Wait()
+
+	result.Failed += int64(len(requests) - dispatched)
+	return result
+}
+
+// dispatch serves a single request and reports whether it was answered with 2xx,
+// and whether its response is written to a cache store once the async writes are finished
+func (w *Warmer) dispatch(ctx context.Context, req WarmRequest) (ok, stored bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			hlog.CtxErrorf(ctx, warmRequestPanicFormat, r, req.URI)
+			ok, stored = false, false
+		}
+	}()
+
+	c := w.engine.NewContext()
+	method := req.Method
+	if method == "" {
+		method = consts.MethodGet
+	}
+	c.Request.SetMethod(method)
+	c.Request.SetRequestURI(req.URI)
+	if req.Host != "" {
+		c.Request.SetHost(req.Host)
+	}
+	for key, value := range req.Header {
+		c.Request.Header.Set(key, value)
+	}
+
+	record := &warmRecord{}
+	w.engine.ServeHTTP(context.WithValue(ctx, warmRecordKey{}, record), c)
+
+	status := c.Response.StatusCode()
+	if status < 200 || status >= 300 {
+		hlog.CtxErrorf(ctx, warmRequestFailFormat, status, req.URI)
+		return false, false
+	}
+	record.pending.Wait()
+	return true, atomic.LoadInt32(&record.stored) == 1
+}
+
+// ParseURLList parses one url per line, either absolute or a request uri.
+// Blank lines and lines starting with # are ignored.
+func ParseURLList(r io.Reader) ([]WarmRequest, error) {
+	var requests []WarmRequest
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		req, err := newWarmRequest(consts.MethodGet, line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		requests = append(requests, req)
+	}
+
+	return requests, scanner.Err()
+}
+
+// ParseAccessLog parses the request lines of an access log in the common or combined log format, e.g.
+//
+//	127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /hello?a=1 HTTP/1.1" 200 2326
+//
+// Only GET requests are returned since replaying other methods is not safe, malformed lines are skipped.
+func ParseAccessLog(r io.Reader) ([]WarmRequest, error) {
+	var requests []WarmRequest
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		start := strings.IndexByte(line, '"')
+		if start < 0 {
+			continue
+		}
+		end := strings.IndexByte(line[start+1:], '"')
+		if end < 0 {
+			continue
+		}
+
+		fields := strings.Fields(line[start+1 : start+1+end])
+		if len(fields) < 2 || fields[0] != consts.MethodGet {
+			continue
+		}
+
+		req, err := newWarmRequest(fields[0], fields[1])
+		if err != nil {
+			continue
+		}
+		requests = append(requests, req)
+	}
+
+	return requests, scanner.Err()
+}
+
+func newWarmRequest(method, rawURL string) (WarmRequest, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return WarmRequest{}, err
+	}
+	if u.Path == "" && u.Host == "" {
+		return WarmRequest{}, fmt.Errorf("invalid url: %s", rawURL)
+	}
+
+	return WarmRequest{
+		Method: method,
+		URI:    u.RequestURI(),
+		Host:   u.Host,
+	}, nil
+}
@@ -0,0 +1,157 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package cache
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/route"
+	"github.com/hertz-contrib/cache/persist"
+)
+
+func TestWarmer(t *testing.T) {
+	memoryStore := persist.NewMemoryStore(1 * time.Minute)
+
+	var backendCount int32
+	r := route.NewEngine(config.NewOptions([]config.Option{}))
+	r.Use(NewCacheByRequestURI(memoryStore, 1*time.Minute))
+	r.GET("/cache", func(ctx context.Context, c *app.RequestContext) {
+		atomic.AddInt32(&backendCount, 1)
+		c.String(http.StatusOK, "uid:"+c.Query("uid"))
+	})
+
+	requests := []WarmRequest{
+		{URI: "/cache?uid=1"},
+		{URI: "/cache?uid=2"},
+		{URI: "/cache?uid=3"},
+		{URI: "/not-found"},
+	}
+	result := NewWarmer(r, 2).Warm(context.Background(), requests)
+	assert.DeepEqual(t, WarmResult{Populated: 3, Failed: 1}, result)
+	assert.DeepEqual(t, int32(3), backendCount)
+
+	respCache := &ResponseCache{}
+	assert.Nil(t, memoryStore.Get(context.Background(), "/cache?uid=2", &respCache))
+	assert.DeepEqual(t, "uid:2", string(respCache.Data))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result = NewWarmer(r, 2).Warm(ctx, requests)
+	assert.DeepEqual(t, int64(len(requests)), result.Populated+result.Uncached+result.Failed)
+}
+
+func TestWarmerUncached(t *testing.T) {
+	newEngine := func(store persist.CacheStore) *route.Engine {
+		r := route.NewEngine(config.NewOptions([]config.Option{}))
+		r.Use(NewCacheByRequestURI(store, 1*time.Minute))
+		r.GET("/cache", func(ctx context.Context, c *app.RequestContext) {
+			c.String(http.StatusOK, "uid:"+c.Query("uid"))
+		})
+		return r
+	}
+	requests := []WarmRequest{{URI: "/cache?uid=1"}, {URI: "/cache?uid=2"}}
+
+	// the responses already cached are not written again
+	r := newEngine(persist.NewMemoryStore(1 * time.Minute))
+	assert.DeepEqual(t, WarmResult{Populated: 2}, NewWarmer(r, 1).Warm(context.Background(), requests))
+	assert.DeepEqual(t, WarmResult{Uncached: 2}, NewWarmer(r, 1).Warm(context.Background(), requests))
+
+	// the failed writes are not counted as populated
+	r = newEngine(failingStore{})
+	assert.DeepEqual(t, WarmResult{Uncached: 2}, NewWarmer(r, 1).Warm(context.Background(), requests))
+}
+
+func TestWarmerAsyncWriter(t *testing.T) {
+	memoryStore := persist.NewMemoryStore(1 * time.Minute)
+	writer := NewAsyncWriter(1, 10, OverflowBlock)
+	defer writer.Close(context.Background())
+
+	r := route.NewEngine(config.NewOptions([]config.Option{}))
+	r.Use(NewCacheByRequestURI(memoryStore, 1*time.Minute, WithAsyncWriter(writer)))
+	r.GET("/cache", func(ctx context.Context, c *app.RequestContext) {
+		c.String(http.StatusOK, "uid:"+c.Query("uid"))
+	})
+
+	// the result waits for the async writes of the requests
+	result := NewWarmer(r, 2).Warm(context.Background(), []WarmRequest{{URI: "/cache?uid=1"}, {URI: "/cache?uid=2"}})
+	assert.DeepEqual(t, WarmResult{Populated: 2}, result)
+	respCache := &ResponseCache{}
+	assert.Nil(t, memoryStore.Get(context.Background(), "/cache?uid=2", &respCache))
+	assert.DeepEqual(t, "uid:2", string(respCache.Data))
+}
+
+func TestParseURLList(t *testing.T) {
+	requests, err := ParseURLList(strings.NewReader(`
+# warm the hot paths
+/hello?a=1
+http://example.com/world
+`))
+	assert.Nil(t, err)
+	assert.DeepEqual(t, []WarmRequest{
+		{Method: http.MethodGet, URI: "/hello?a=1"},
+		{Method: http.MethodGet, URI: "/world", Host: "example.com"},
+	}, requests)
+
+	_, err = ParseURLList(strings.NewReader("http://"))
+	assert.NotNil(t, err)
+}
+
+func TestParseAccessLog(t *testing.T) {
+	requests, err := ParseAccessLog(strings.NewReader(
+		`127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /hello?a=1 HTTP/1.1" 200 2326
+127.0.0.1 - frank [10/Oct/2000:13:55:37 -0700] "POST /users HTTP/1.1" 201 12
+malformed line
+127.0.0.1 - - [10/Oct/2000:13:55:38 -0700] "GET /world HTTP/1.1" 200 10 "-" "curl/7.64.1"
+`))
+	assert.Nil(t, err)
+	assert.DeepEqual(t, []WarmRequest{
+		{Method: http.MethodGet, URI: "/hello?a=1"},
+		{Method: http.MethodGet, URI: "/world"},
+	}, requests)
+}
@@ -0,0 +1,78 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package cache
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// expiresEarly reports whether the entry is considered expired ahead of its expiration by XFetch.
+// The probability grows as the expiration approaches and with the computation duration of the entry,
+// see "Optimal Probabilistic Cache Stampede Prevention" by Vattani et al.
+func (o *Options) expiresEarly(respCache *ResponseCache) bool {
+	if o.earlyExpirationBeta <= 0 || respCache.ExpireAt.IsZero() || respCache.Delta <= 0 {
+		return false
+	}
+
+	r := o.randFloat64()
+	if r <= 0 {
+		return true
+	}
+	gap := time.Duration(-float64(respCache.Delta) * o.earlyExpirationBeta * math.Log(r))
+	return !time.Now().Add(gap).Before(respCache.ExpireAt)
+}
+
+// refreshSet records the keys being refreshed ahead of their expiration
+type refreshSet struct {
+	keys sync.Map
+}
+
+// start reports whether the caller should refresh the key, false if another request is refreshing it
+func (s *refreshSet) start(key string) bool {
+	_, loaded := s.keys.LoadOrStore(key, struct{}{})
+	return !loaded
+}
+
+func (s *refreshSet) done(key string) {
+	s.keys.Delete(key)
+}
@@ -0,0 +1,147 @@
+/*
+ * Copyright 2022 CloudWeGo Authors
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ * The MIT License (MIT)
+ *
+ * Copyright (c) 2021 cyhone
+ *
+ * Permission is hereby granted, free of charge, to any person obtaining a copy
+ * of this software and associated documentation files (the "Software"), to deal
+ * in the Software without restriction, including without limitation the rights
+ * to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+ * copies of the Software, and to permit persons to whom the Software is
+ * furnished to do so, subject to the following conditions:
+ *
+ * The above copyright notice and this permission notice shall be included in all
+ * copies or substantial portions of the Software.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+ * IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+ * FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+ * AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+ * LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+ * OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+ * SOFTWARE.
+ *
+* This file may have been modified by CloudWeGo authors. All CloudWeGo
+* Modifications are Copyright 2022 CloudWeGo Authors.
+*/
+
+package cache
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cloudwego/hertz/pkg/app"
+	"github.com/cloudwego/hertz/pkg/common/config"
+	"github.com/cloudwego/hertz/pkg/common/test/assert"
+	"github.com/cloudwego/hertz/pkg/common/ut"
+	"github.com/cloudwego/hertz/pkg/route"
+	"github.com/hertz-contrib/cache/persist"
+)
+
+func withRandFloat64(f func() float64) Option {
+	return Option{
+		F: func(o *Options) {
+			o.randFloat64 = f
+		},
+	}
+}
+
+func TestExpiresEarly(t *testing.T) {
+	respCache := &ResponseCache{
+		ExpireAt: time.Now().Add(time.Minute),
+		Delta:    time.Second,
+	}
+
+	options := newOptions(withRandFloat64(func() float64 { return 0.5 }))
+	assert.False(t, options.expiresEarly(respCache))
+
+	// -1s * 1.0 * ln(0.5) is about 0.7s before the expiration
+	options.Apply([]Option{WithEarlyExpiration(1)})
+	assert.False(t, options.expiresEarly(respCache))
+	respCache.ExpireAt = time.Now().Add(500 * time.Millisecond)
+	assert.True(t, options.expiresEarly(respCache))
+
+	// a greater beta expires earlier
+	respCache.ExpireAt = time.Now().Add(time.Minute)
+	options.Apply([]Option{WithEarlyExpiration(100)})
+	assert.True(t, options.expiresEarly(respCache))
+
+	// entries without the computation duration never expire early
+	respCache.Delta = 0
+	assert.False(t, options.expiresEarly(respCache))
+}
+
+func TestEarlyExpiration(t *testing.T) {
+	var backendCount int32
+	var earlyExpiration int32
+	var missCount int32
+	gate := make(chan struct{})
+	memoryStore := persist.NewMemoryStore(time.Minute)
+
+	r := route.NewEngine(config.NewOptions([]config.Option{}))
+	r.Use(NewCacheByRequestURI(memoryStore, time.Minute,
+		WithEarlyExpiration(1),
+		WithOnMissCache(func(ctx context.Context, c *app.RequestContext) {
+			atomic.AddInt32(&missCount, 1)
+		}),
+		withRandFloat64(func() float64 {
+			if atomic.LoadInt32(&earlyExpiration) == 1 {
+				return 0
+			}
+			return 1
+		})))
+	r.GET("/cache", func(ctx context.Context, c *app.RequestContext) {
+		count := atomic.AddInt32(&backendCount, 1)
+		if count > 1 {
+			<-gate
+		}
+		c.String(http.StatusOK, "backend:"+strconv.Itoa(int(count)))
+	})
+
+	w := ut.PerformRequest(r, "GET", "/cache", nil)
+	assert.DeepEqual(t, "backend:1", w.Body.String())
+	w = ut.PerformRequest(r, "GET", "/cache", nil)
+	assert.DeepEqual(t, "backend:1", w.Body.String())
+
+	// one request refreshes the entry, the others still hit
+	atomic.StoreInt32(&earlyExpiration, 1)
+	done := make(chan string)
+	go func() {
+		done <- ut.PerformRequest(r, "GET", "/cache", nil).Body.String()
+	}()
+	for atomic.LoadInt32(&backendCount) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	w = ut.PerformRequest(r, "GET", "/cache", nil)
+	assert.DeepEqual(t, "backend:1", w.Body.String())
+
+	close(gate)
+	assert.DeepEqual(t, "backend:2", <-done)
+	assert.DeepEqual(t, int32(2), atomic.LoadInt32(&backendCount))
+	// the refresh is reported as a miss like in the metrics
+	assert.DeepEqual(t, int32(2), atomic.LoadInt32(&missCount))
+
+	respCache := &ResponseCache{}
+	assert.Nil(t, memoryStore.Get(context.Background(), "/cache", &respCache))
+	assert.DeepEqual(t, "backend:2", string(respCache.Data))
+	assert.True(t, respCache.Delta > 0)
+	assert.DeepEqual(t, respCache.CreatedAt.Add(time.Minute), respCache.ExpireAt)
+}